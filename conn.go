@@ -0,0 +1,248 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InstrumentedConn is a Conn that records the last query run through it,
+// which is useful for debugging test failures.
+type InstrumentedConn struct {
+	c Conn
+
+	mu        sync.Mutex
+	lastQuery string
+	lastArgs  []interface{}
+}
+
+// Instrument returns an InstrumentedConn delegating to c. It's intended
+// for tests and debug builds.
+func Instrument(c Conn) *InstrumentedConn {
+	return &InstrumentedConn{c: c}
+}
+
+// LastQuery returns the most recent query run through the conn and its
+// arguments. It returns an empty query if none has been run.
+func (c *InstrumentedConn) LastQuery() (string, []interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastQuery, c.lastArgs
+}
+
+func (c *InstrumentedConn) record(query string, args []interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastQuery, c.lastArgs = query, args
+}
+
+func (c *InstrumentedConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	c.record(query, args)
+	return c.c.Exec(query, args...)
+}
+
+func (c *InstrumentedConn) Query(query string, args ...interface{}) (Rows, error) {
+	c.record(query, args)
+	return c.c.Query(query, args...)
+}
+
+func (c *InstrumentedConn) QueryRow(query string, args ...interface{}) Row {
+	c.record(query, args)
+	return c.c.QueryRow(query, args...)
+}
+
+// queryerContext is implemented by *sql.DB, *sql.Tx, and *sql.Conn.
+type queryerContext interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// ctxConn is a Conn that runs each statement with a context returned by
+// newContext. The context is cancelled once the statement's result has
+// been consumed: when Exec returns, a Row is scanned, or Rows are closed.
+// The func returned by q alongside the queryer is called once the
+// statement has started.
+type ctxConn struct {
+	q          func() (queryerContext, func())
+	newContext func() (context.Context, context.CancelFunc)
+}
+
+func (c *ctxConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := c.newContext()
+	defer cancel()
+	q, release := c.q()
+	defer release()
+	return q.ExecContext(ctx, query, args...)
+}
+
+func (c *ctxConn) Query(query string, args ...interface{}) (Rows, error) {
+	ctx, cancel := c.newContext()
+	q, release := c.q()
+	rows, err := q.QueryContext(ctx, query, args...)
+	release()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (c *ctxConn) QueryRow(query string, args ...interface{}) Row {
+	ctx, cancel := c.newContext()
+	q, release := c.q()
+	row := q.QueryRowContext(ctx, query, args...)
+	release()
+	return &cancelRow{row: row, cancel: cancel}
+}
+
+// cancelRows cancels its query's context when closed.
+type cancelRows struct {
+	*sql.Rows
+	cancel context.CancelFunc
+}
+
+func (r *cancelRows) Close() error {
+	err := r.Rows.Close()
+	r.cancel()
+	return err
+}
+
+// cancelRow cancels its query's context once scanned.
+type cancelRow struct {
+	row    *sql.Row
+	cancel context.CancelFunc
+}
+
+func (r *cancelRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.row.Scan(dest...)
+}
+
+// WithStatementTimeout returns a Conn whose statements are each run with
+// a context that times out after d. It's a simple way to bound statements
+// at call sites that don't manage their own contexts. The Rows returned
+// by Query must be closed to release their context.
+func (db *DB) WithStatementTimeout(d time.Duration) Conn {
+	return &ctxConn{
+		q: func() (queryerContext, func()) { return db.acquirePool() },
+		newContext: func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), d)
+		},
+	}
+}
+
+// WithContext returns a Conn whose statements are all run with ctx, so
+// code written against Conn can be cancelled without changing its
+// signatures. Once ctx is done, every statement run through the Conn
+// fails with its error.
+func (db *DB) WithContext(ctx context.Context) Conn {
+	return &ctxConn{
+		q: func() (queryerContext, func()) { return db.acquirePool() },
+		newContext: func() (context.Context, context.CancelFunc) {
+			return context.WithCancel(ctx)
+		},
+	}
+}
+
+// QueryWithMaxExecTime runs query, which must be a SELECT, with a
+// MAX_EXECUTION_TIME optimizer hint so the server aborts it once it has
+// run for d, to the millisecond. It suits heavy queries that need a
+// different limit to the server's max_execution_time. The hint is added
+// to the query's existing hint comment, if it has one, since MySQL only
+// reads the first. The query is run with ctx if c supports it.
+func QueryWithMaxExecTime(ctx context.Context, c Conn, d time.Duration, query string, args ...interface{}) (Rows, error) {
+	query, err := withMaxExecutionTime(query, d)
+	if err != nil {
+		return nil, err
+	}
+
+	if qc, ok := c.(rowsQueryerContext); ok {
+		return qc.QueryContext(ctx, query, args...)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Query(query, args...)
+}
+
+// withMaxExecutionTime adds a MAX_EXECUTION_TIME hint of d to the SELECT
+// query.
+func withMaxExecutionTime(query string, d time.Duration) (string, error) {
+	ms := d.Milliseconds()
+	if ms <= 0 {
+		return "", fmt.Errorf("max execution time must be at least 1ms, got %s", d)
+	}
+
+	verb, end := firstWord(query)
+	if !strings.EqualFold(verb, "SELECT") {
+		return "", fmt.Errorf("max execution time can only be set for a SELECT, got %s", verb)
+	}
+
+	hint := "MAX_EXECUTION_TIME(" + strconv.FormatInt(ms, 10) + ")"
+	rest := query[end:]
+	if trimmed := strings.TrimLeft(rest, " \t\r\n"); strings.HasPrefix(trimmed, "/*+") {
+		at := end + len(rest) - len(trimmed) + len("/*+")
+		return query[:at] + " " + hint + query[at:], nil
+	}
+	return query[:end] + " /*+ " + hint + " */" + rest, nil
+}
+
+// ErrQueryTooLong is returned by a Conn from LimitQueryLength when a
+// query exceeds its maximum length.
+var ErrQueryTooLong = errors.New("query is too long")
+
+// LimitQueryLength returns a Conn delegating to c that rejects queries
+// longer than maxBytes with ErrQueryTooLong, without sending them to the
+// server. It guards against runaway queries assembled from user input.
+func LimitQueryLength(c Conn, maxBytes int) Conn {
+	return &limitConn{c: c, max: maxBytes}
+}
+
+// limitConn is a Conn that rejects queries longer than max bytes.
+type limitConn struct {
+	c   Conn
+	max int
+}
+
+func (c *limitConn) check(query string) error {
+	if len(query) > c.max {
+		return fmt.Errorf("%w: %d bytes exceeds the limit of %d", ErrQueryTooLong, len(query), c.max)
+	}
+	return nil
+}
+
+func (c *limitConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if err := c.check(query); err != nil {
+		return nil, err
+	}
+	return c.c.Exec(query, args...)
+}
+
+func (c *limitConn) Query(query string, args ...interface{}) (Rows, error) {
+	if err := c.check(query); err != nil {
+		return nil, err
+	}
+	return c.c.Query(query, args...)
+}
+
+func (c *limitConn) QueryRow(query string, args ...interface{}) Row {
+	if err := c.check(query); err != nil {
+		return errRow{err}
+	}
+	return c.c.QueryRow(query, args...)
+}
+
+// errRow is a Row whose Scan returns err.
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
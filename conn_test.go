@@ -0,0 +1,147 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrument(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	c := Instrument(&DB{db: srv.open(t)})
+
+	query, args := c.LastQuery()
+	assert.Empty(t, query)
+	assert.Nil(t, args)
+
+	_, err := c.Exec("UPDATE users SET name = ? WHERE id = ?;", "gavin", 1)
+	require.NoError(t, err)
+	query, args = c.LastQuery()
+	assert.Equal(t, "UPDATE users SET name = ? WHERE id = ?;", query)
+	assert.Equal(t, []interface{}{"gavin", 1}, args)
+
+	rows, err := c.Query("SELECT id FROM users;")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	query, args = c.LastQuery()
+	assert.Equal(t, "SELECT id FROM users;", query)
+	assert.Empty(t, args)
+}
+
+// sleepHandler answers SELECT SLEEP queries by blocking until their
+// context is done, and every other query with a single row.
+func sleepHandler(q fakeQuery) (fakeResult, error) {
+	if q.query == "SELECT SLEEP(10);" {
+		<-q.ctx.Done()
+		return fakeResult{}, q.ctx.Err()
+	}
+	return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(1)}}}, nil
+}
+
+func TestWithStatementTimeout(t *testing.T) {
+	srv := newFakeServer(t, sleepHandler)
+	c := (&DB{db: srv.open(t)}).WithStatementTimeout(50 * time.Millisecond)
+
+	_, err := c.Exec("SELECT SLEEP(10);")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var n int
+	assert.ErrorIs(t, c.QueryRow("SELECT SLEEP(10);").Scan(&n), context.DeadlineExceeded)
+
+	require.NoError(t, c.QueryRow("SELECT 1;").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	rows, err := c.Query("SELECT 1;")
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&n))
+	assert.Equal(t, 1, n)
+}
+
+func TestWithContext(t *testing.T) {
+	srv := newFakeServer(t, sleepHandler)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := (&DB{db: srv.open(t)}).WithContext(ctx)
+
+	var n int
+	require.NoError(t, c.QueryRow("SELECT 1;").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := c.Exec("SELECT SLEEP(10);")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = c.Exec("SELECT 1;")
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = c.Query("SELECT 1;")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, c.QueryRow("SELECT 1;").Scan(&n), context.Canceled)
+}
+
+func TestLimitQueryLength(t *testing.T) {
+	srv := newFakeServer(t, sleepHandler)
+	c := LimitQueryLength(&DB{db: srv.open(t)}, 20)
+
+	var n int
+	require.NoError(t, c.QueryRow("SELECT 1;").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	long := "SELECT * FROM users WHERE id IN (1, 2, 3);"
+	_, err := c.Exec(long)
+	assert.ErrorIs(t, err, ErrQueryTooLong)
+	_, err = c.Query(long)
+	assert.ErrorIs(t, err, ErrQueryTooLong)
+	assert.ErrorIs(t, c.QueryRow(long).Scan(&n), ErrQueryTooLong)
+
+	assert.Equal(t, []string{"SELECT 1;"}, srv.queries())
+}
+
+func TestWithMaxExecutionTime(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM events;":                       "SELECT /*+ MAX_EXECUTION_TIME(1500) */ * FROM events;",
+		"  select id FROM events;":                    "  select /*+ MAX_EXECUTION_TIME(1500) */ id FROM events;",
+		"-- report\nSELECT\nid FROM events;":          "-- report\nSELECT /*+ MAX_EXECUTION_TIME(1500) */\nid FROM events;",
+		"SELECT /*+ BKA(e) */ id FROM events e;":      "SELECT /*+ MAX_EXECUTION_TIME(1500) BKA(e) */ id FROM events e;",
+		"SELECT /* not a hint */ id FROM events;":     "SELECT /*+ MAX_EXECUTION_TIME(1500) */ /* not a hint */ id FROM events;",
+		"SELECT DISTINCT user_id FROM events LIMIT 1": "SELECT /*+ MAX_EXECUTION_TIME(1500) */ DISTINCT user_id FROM events LIMIT 1",
+	}
+	for query, want := range tests {
+		got, err := withMaxExecutionTime(query, 1500*time.Millisecond)
+		require.NoError(t, err, query)
+		assert.Equal(t, want, got, query)
+	}
+}
+
+func TestWithMaxExecutionTimeInvalid(t *testing.T) {
+	for _, query := range []string{"UPDATE events SET seen = 1;", "/* SELECT */ DELETE FROM events;", "selected"} {
+		_, err := withMaxExecutionTime(query, time.Second)
+		assert.Error(t, err, query)
+	}
+
+	_, err := withMaxExecutionTime("SELECT 1;", 500*time.Microsecond)
+	assert.Error(t, err)
+}
+
+func TestQueryWithMaxExecTime(t *testing.T) {
+	srv := newFakeServer(t, sleepHandler)
+	db := &DB{db: srv.open(t)}
+
+	rows, err := QueryWithMaxExecTime(context.Background(), db, 2*time.Second, "SELECT id FROM events WHERE user_id = ?;", 1)
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Equal(t, []string{"SELECT /*+ MAX_EXECUTION_TIME(2000) */ id FROM events WHERE user_id = ?;"}, srv.queries())
+
+	_, err = QueryWithMaxExecTime(context.Background(), db, time.Second, "DELETE FROM events;")
+	assert.Error(t, err)
+	assert.Len(t, srv.queries(), 1, "nothing else runs")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = QueryWithMaxExecTime(ctx, db, time.Second, "SELECT 1;")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,73 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// WithConnectionInit returns an option that will configure the DB to
+// execute queries, in order, on every new connection opened by the pool
+// before it's used, such as `SET NAMES utf8mb4`. A connection is discarded
+// if any of them fail.
+func WithConnectionInit(queries ...string) Option {
+	return func(db *DB) {
+		db.connInit = append(db.connInit, queries...)
+	}
+}
+
+// openPool opens a pool to the DB's dsn which runs the connection init
+// queries on every new connection.
+func (db *DB) openPool() (*sql.DB, error) {
+	if len(db.connInit) == 0 {
+		return sql.Open(db.driverName, db.dsn)
+	}
+
+	// database/sql only exposes a registered driver through a pool
+	sdb, err := sql.Open(db.driverName, db.dsn)
+	if err != nil {
+		return nil, err
+	}
+	drv := sdb.Driver()
+	sdb.Close()
+
+	dc, ok := drv.(driver.DriverContext)
+	if !ok {
+		return nil, fmt.Errorf("driver %s doesn't support connection init queries", db.driverName)
+	}
+	connector, err := dc.OpenConnector(db.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.OpenDB(&initConnector{Connector: connector, queries: db.connInit}), nil
+}
+
+// initConnector is a driver.Connector that executes queries on each
+// connection it opens.
+type initConnector struct {
+	driver.Connector
+	queries []string
+}
+
+func (c *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("connection of type %T can't execute init queries", conn)
+	}
+
+	for _, query := range c.queries {
+		if _, err = execer.ExecContext(ctx, query, nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("executing connection init query: %w", err)
+		}
+	}
+	return conn, nil
+}
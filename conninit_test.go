@@ -0,0 +1,53 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithConnectionInit(t *testing.T) {
+	var mu sync.Mutex
+	initialized := map[int]bool{}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if q.query == "SET SESSION group_concat_max_len = 1000000;" {
+			initialized[q.conn] = true
+			return fakeResult{}, nil
+		}
+		value := "1024"
+		if initialized[q.conn] {
+			value = "1000000"
+		}
+		return fakeResult{columns: []string{"v"}, rows: [][]driver.Value{{value}}}, nil
+	})
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithConnectionInit("SET SESSION group_concat_max_len = 1000000;"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// close every connection once it's used, so each query opens a new one
+	db.sqlDB().SetMaxIdleConns(0)
+	for i := 0; i < 3; i++ {
+		var v string
+		require.NoError(t, db.QueryRow("SELECT @@group_concat_max_len;").Scan(&v))
+		assert.Equal(t, "1000000", v)
+	}
+	assert.GreaterOrEqual(t, srv.connections(), 3)
+}
+
+func TestWithConnectionInitError(t *testing.T) {
+	errInit := errors.New("unknown system variable")
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{}, errInit
+	})
+
+	_, err := NewDB(srv.dsn("app"), withFakeDriver(), WithConnectionInit("SET SESSION nope = 1;"))
+	assert.ErrorIs(t, err, errInit)
+}
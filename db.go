@@ -1,12 +1,14 @@
 package mysqldb
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/fs"
-	"path"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	// mysql driver
@@ -16,61 +18,232 @@ import (
 // DB wraps a SQL database with specific functionality
 type DB struct {
 	db            *sql.DB
+	dbMu          sync.RWMutex
+	poolUsers     sync.Map // *sql.DB to the *sync.WaitGroup of its users
+	driverName    string
 	name          string
 	dsn           string
 	autoCreate    bool
+	onCreate      func(Conn) error
 	dropExisting  bool
 	migrationsDir string
 	migrationsFS  fs.FS
 	dropOnClose   bool
+
+	// migrationSources records every source of migrations configured, so
+	// conflicting options can be reported rather than silently replaced.
+	migrationSources []migrationSource
+
+	noDefaultDatabase bool
+	createCharset     string
+	createCollation   string
+
+	requireMigrations        bool
+	bootstrap                *bootstrapSchema
+	deferMigrations          bool
+	migrationTemplateData    map[string]interface{}
+	statementLevelMigrations bool
+	beforeMigrate            func(Conn) error
+	afterMigrate             func(Conn) error
+	migrationProgress        func(done, total int, name string)
+	migrationLess            func(a, b string) bool
+	migrationTransform       func(filename, sql string) (string, error)
+	modifiedMigrationPolicy  ModifiedMigrationPolicy
+	migrateConcurrency       int
+	transactionalDML         bool
+	appendOnlyMigrations     bool
+	allowEmptyMigrations     bool
+	maxMigrationSize         int64
+	migrationConn            Conn
+	fieldMapper              func(string) string
+	tableLockTTL             time.Duration
+
+	configureDSN []func(*mysql.Config) error
+	connInit     []string
+
+	reconnectMax    time.Duration
+	reconnectMu     sync.Mutex
+	reconnectJitter bool
+	reconnectRand   func(n int64) int64
+
+	recreateOnUnknownDB bool
+	recreating          atomic.Bool
+
+	session   *sql.Conn
+	sessionDB string
+	sessionMu sync.Mutex
+
+	logger             Logger
+	slowQueryThreshold time.Duration
+	redactSQL          bool
+	argRedactor        func(args []interface{}) []interface{}
+}
+
+// sqlDB returns the current underlying pool. The pool may be replaced
+// when WithAutoReconnect is used.
+func (db *DB) sqlDB() *sql.DB {
+	db.dbMu.RLock()
+	defer db.dbMu.RUnlock()
+	return db.db
 }
 
-func (db *DB) BeginTx() (*Tx, error) {
-	tx, err := db.db.Begin()
+// BeginTx starts a transaction. The provided context is used until the
+// transaction is committed or rolled back.
+func (db *DB) BeginTx(ctx context.Context) (*Tx, error) {
+	var tx *sql.Tx
+	err := db.withReconnect(func(sdb *sql.DB) (err error) {
+		tx, err = sdb.BeginTx(ctx, nil)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &Tx{
-		tx: tx,
+		tx:          tx,
+		done:        new(atomic.Bool),
+		fieldMapper: db.fieldMapper,
 	}, nil
 }
 
 func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return db.db.Exec(query, args...)
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext is Exec with a context for the statement.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer db.logSlowQuery(time.Now(), query, args)
+
+	var res sql.Result
+	err := db.withReconnect(func(sdb *sql.DB) (err error) {
+		res, err = sdb.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
 }
 
 func (db *DB) Query(query string, args ...interface{}) (Rows, error) {
-	return db.db.Query(query, args...)
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext is Query with a context for the query.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	defer db.logSlowQuery(time.Now(), query, args)
+
+	var rows *sql.Rows
+	err := db.withReconnect(func(sdb *sql.DB) (err error) {
+		rows, err = sdb.QueryContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
 }
 
 func (db *DB) QueryRow(query string, args ...interface{}) Row {
-	return db.db.QueryRow(query, args...)
+	return db.QueryRowContext(context.Background(), query, args...)
 }
 
+// QueryRowContext is QueryRow with a context for the query.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	defer db.logSlowQuery(time.Now(), query, args)
+
+	sdb, release := db.acquirePool()
+	row := sdb.QueryRowContext(ctx, query, args...)
+	release()
+	if db.reconnectMax <= 0 && !db.recreateOnUnknownDB {
+		return row
+	}
+	return &reconnectRow{db: db, row: row, ctx: ctx, query: query, args: args}
+}
+
+// ErrTxDone is returned by the methods of a Tx that has already been
+// committed or rolled back. It's sql.ErrTxDone, so it also matches the
+// errors returned by the underlying transaction.
+var ErrTxDone = sql.ErrTxDone
+
 // Tx wraps a sql Tx.
 type Tx struct {
-	tx *sql.Tx
+	tx          *sql.Tx
+	depth       int
+	done        *atomic.Bool // shared with nested Txs
+	fieldMapper func(string) string
+
+	// ctx is used for every statement when set by BeginTxWithDeadline,
+	// and cancel releases it once the transaction is done.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Active reports whether the transaction is still open, i.e. it hasn't
+// been committed or rolled back.
+func (tx *Tx) Active() bool {
+	return !tx.done.Load()
+}
+
+// context returns the context statements in the transaction are run with.
+func (tx *Tx) context() context.Context {
+	if tx.ctx == nil {
+		return context.Background()
+	}
+	return tx.ctx
+}
+
+// check returns the error a statement in the transaction should fail
+// with before it's run, if any.
+func (tx *Tx) check() error {
+	if !tx.Active() {
+		return ErrTxDone
+	}
+	if tx.ctx != nil {
+		return tx.ctx.Err()
+	}
+	return nil
+}
+
+// release cancels the transaction's context, if it has its own.
+func (tx *Tx) release() {
+	if tx.cancel != nil {
+		tx.cancel()
+	}
 }
 
 func (tx *Tx) Rollback() error {
+	if tx.done.Swap(true) {
+		return ErrTxDone
+	}
+	defer tx.release()
 	return tx.tx.Rollback()
 }
 
 func (tx *Tx) Commit() error {
+	if tx.done.Swap(true) {
+		return ErrTxDone
+	}
+	defer tx.release()
 	return tx.tx.Commit()
 }
 
 func (tx *Tx) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return tx.tx.Exec(query, args...)
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.tx.ExecContext(tx.context(), query, args...)
 }
 
 func (tx *Tx) Query(query string, args ...interface{}) (Rows, error) {
-	return tx.tx.Query(query, args...)
+	if err := tx.check(); err != nil {
+		return nil, err
+	}
+	return tx.tx.QueryContext(tx.context(), query, args...)
 }
 
 func (tx *Tx) QueryRow(query string, args ...interface{}) Row {
-	return tx.tx.QueryRow(query, args...)
+	if err := tx.check(); err != nil {
+		return errRow{err}
+	}
+	return tx.tx.QueryRowContext(tx.context(), query, args...)
 }
 
 type Scanner interface {
@@ -81,10 +254,14 @@ type Row interface {
 	Scanner
 }
 
+// Rows is the result of a query. Its columns can be inspected before
+// scanning with Columns and ColumnTypes.
 type Rows interface {
 	Row
 	Next() bool
 	Close() error
+	Columns() ([]string, error)
+	ColumnTypes() ([]*sql.ColumnType, error)
 }
 
 // Conn is used as a common interface for DB and DBWithTx.
@@ -96,6 +273,26 @@ type Conn interface {
 	QueryRow(query string, args ...interface{}) Row
 }
 
+// TxBeginner is implemented by a Conn that can start a transaction, such
+// as a DB. A Tx doesn't implement it since MySQL doesn't support nested
+// transactions, so helpers accepting a Conn can type-assert to TxBeginner
+// to decide whether to start a new transaction or join the existing one.
+type TxBeginner interface {
+	BeginTx(ctx context.Context) (*Tx, error)
+}
+
+var (
+	_ Conn       = (*DB)(nil)
+	_ Conn       = (*Tx)(nil)
+	_ TxBeginner = (*DB)(nil)
+	_ Rows       = (*sql.Rows)(nil)
+	_ Rows       = (*cancelRows)(nil)
+)
+
+// ErrNoDatabaseName is returned by NewDB when the DSN doesn't name a
+// database and WithNoDefaultDatabase isn't used.
+var ErrNoDatabaseName = errors.New("dsn has no database name: add one to the dsn, or use WithNoDefaultDatabase to connect to the server without a default database")
+
 // Option is an option to be applied to the DB.
 type Option func(*DB)
 
@@ -108,6 +305,28 @@ func AutoCreateDB() Option {
 	}
 }
 
+// WithOnCreate returns an option that will configure the DB to call fn
+// when AutoCreateDB creates the database, but not when it already exists,
+// such as to grant privileges on it. fn is called once the DB has
+// connected to the new database, before any migrations are run. An error
+// from fn fails NewDB.
+func WithOnCreate(fn func(Conn) error) Option {
+	return func(db *DB) {
+		db.onCreate = fn
+	}
+}
+
+// WithCreateCharset returns an option that will configure the default
+// charset and collation of a database created by AutoCreateDB. They
+// default to utf8mb4 and utf8mb4_unicode_ci. Empty values leave them to
+// the server's defaults.
+func WithCreateCharset(charset, collation string) Option {
+	return func(db *DB) {
+		db.createCharset = charset
+		db.createCollation = collation
+	}
+}
+
 // DropExistingDB returns an option that will configure the DB to
 // drop the database if it currently exists. This would be useful if
 // the DB needs dropped before using the AutoCreateDB Option.
@@ -122,10 +341,12 @@ func DropExistingDB() Option {
 // and only files with a `.sql` extension will be run. The migration
 // files are sorted by filename and then executed in that order.
 // If the directory string provided is empty, no migrations will be run.
+// Only one source of migrations can be configured: NewDB fails with
+// ErrConflictingMigrations if WithMigrations or WithMigrationsPath is
+// used more than once with different arguments.
 func WithMigrations(migrationsFS fs.FS, migrationsDir string) Option {
 	return func(db *DB) {
-		db.migrationsFS = migrationsFS
-		db.migrationsDir = migrationsDir
+		db.setMigrationSource(migrationsFS, migrationsDir)
 	}
 }
 
@@ -138,46 +359,94 @@ func DropDBOnClose() Option {
 	}
 }
 
+// WithNoDefaultDatabase returns an option that will allow the DB to be
+// created from a DSN without a database name, connecting to the server
+// without a default database. This is useful for server-level admin tasks.
+// Queries must then qualify table names with their database.
+func WithNoDefaultDatabase() Option {
+	return func(db *DB) {
+		db.noDefaultDatabase = true
+	}
+}
+
 // NewDB returns a new DB with any necessary actions from the given options performed.
 func NewDB(dsn string, options ...Option) (*DB, error) {
+	return NewDBContext(context.Background(), dsn, options...)
+}
+
+// NewDBContext is like NewDB, but stops connecting to the database and
+// running migrations once ctx is done. Migrations that completed before
+// then stay recorded.
+func NewDBContext(ctx context.Context, dsn string, options ...Option) (*DB, error) {
 	cfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("parsing dsn: %w", err)
 	}
 
-	d := &DB{name: cfg.DBName, dsn: dsn}
+	d := &DB{
+		driverName:      "mysql",
+		name:            cfg.DBName,
+		dsn:             dsn,
+		createCharset:   "utf8mb4",
+		createCollation: "utf8mb4_unicode_ci",
+	}
 	for _, o := range options {
 		o(d)
 	}
 
+	if d.name == "" && !d.noDefaultDatabase {
+		return nil, ErrNoDatabaseName
+	}
+
+	if err = d.checkMigrationSources(); err != nil {
+		return nil, err
+	}
+
+	if len(d.configureDSN) > 0 {
+		for _, configure := range d.configureDSN {
+			if err = configure(cfg); err != nil {
+				return nil, fmt.Errorf("configuring dsn: %w", err)
+			}
+		}
+		d.dsn = cfg.FormatDSN()
+	}
+
 	if d.dropExisting {
 		cfg.DBName = ""
-		if err = dropExistingDatabaseIfExist(cfg.FormatDSN(), d.name); err != nil {
+		if err = dropExistingDatabaseIfExist(d.driverName, cfg.FormatDSN(), d.name); err != nil {
 			return nil, fmt.Errorf("dropping existing database: %w", err)
 		}
 		cfg.DBName = d.name
 	}
 
+	created := false
 	if d.autoCreate {
 		cfg.DBName = ""
-		if err = createDatabaseIfNotExist(cfg.FormatDSN(), d.name); err != nil {
+		if created, err = createDatabaseIfNotExist(d.driverName, cfg.FormatDSN(), d.name, d.createCharset, d.createCollation); err != nil {
 			return nil, fmt.Errorf("auto-creating database: %w", err)
 		}
 		cfg.DBName = d.name
 	}
 
-	d.db, err = sql.Open("mysql", dsn)
+	d.db, err = d.openPool()
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
 
-	if err = d.db.Ping(); err != nil {
+	if err = d.db.PingContext(ctx); err != nil {
 		d.db.Close()
-		return nil, err
+		return nil, pingError(err, cfg)
+	}
+
+	if created && d.onCreate != nil {
+		if err = d.onCreate(d); err != nil {
+			d.db.Close()
+			return nil, fmt.Errorf("running on create hook: %w", err)
+		}
 	}
 
-	if d.migrationsDir != "" {
-		if err = d.runMigrations(); err != nil {
+	if d.hasMigrations() && !d.deferMigrations {
+		if err = d.runMigrations(ctx); err != nil {
 			d.db.Close()
 			return nil, fmt.Errorf("running migrations: %w", err)
 		}
@@ -186,11 +455,32 @@ func NewDB(dsn string, options ...Option) (*DB, error) {
 	return d, nil
 }
 
+// pingError wraps an error from the initial ping with the address of the
+// server and a hint distinguishing bad credentials from an unreachable
+// server.
+func pingError(err error, cfg *mysql.Config) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1045 { // access denied
+		return fmt.Errorf("pinging database at %s: access denied for user %q, are the credentials correct?: %w", cfg.Addr, cfg.User, err)
+	}
+	return fmt.Errorf("pinging database: is MySQL reachable at %s?: %w", cfg.Addr, err)
+}
+
+// Name returns the name of the database from the DSN the DB was opened
+// with. It's empty if WithNoDefaultDatabase was used without one.
+func (db *DB) Name() string {
+	return db.name
+}
+
 // Close handles closing any underlying resources for the database. It also
 // runs any of the specified options that are required at the end of the database's
 // use, such as DropDBOnClose.
 func (db *DB) Close() error {
-	err := db.db.Close()
+	if err := db.closeSession(); err != nil {
+		return err
+	}
+
+	err := db.sqlDB().Close()
 	if err != nil {
 		return fmt.Errorf("closing database: %w", err)
 	}
@@ -205,146 +495,130 @@ func (db *DB) Close() error {
 	}
 
 	cfg.DBName = ""
-	return dropExistingDatabaseIfExist(cfg.FormatDSN(), db.name)
+	return dropExistingDatabaseIfExist(db.driverName, cfg.FormatDSN(), db.name)
 }
 
-func createDatabaseIfNotExist(dsn, dbName string) error {
-	db, err := sql.Open("mysql", dsn)
+// Recreate drops and recreates the database, then runs the migrations
+// again, resetting it for reuse, such as between tests. A new pool is
+// opened to the recreated database and replaces the current one, which
+// is closed. If the database can't be dropped, the DB is left as it was.
+func (db *DB) Recreate() error {
+	if db.name == "" {
+		return ErrNoDatabaseName
+	}
+
+	cfg, err := mysql.ParseDSN(db.dsn)
 	if err != nil {
-		return fmt.Errorf("opening database: %w", err)
+		return fmt.Errorf("parsing dsn: %w", err)
 	}
-	defer db.Close()
+	cfg.DBName = ""
+	serverDSN := cfg.FormatDSN()
 
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("pinging database: %w", err)
+	if err = db.closeSession(); err != nil {
+		return err
 	}
 
-	_, err = db.Exec(`CREATE DATABASE IF NOT EXISTS ` + dbName + `;`)
-	if err != nil {
+	if err = dropExistingDatabaseIfExist(db.driverName, serverDSN, db.name); err != nil {
+		return fmt.Errorf("dropping database: %w", err)
+	}
+	if _, err = createDatabaseIfNotExist(db.driverName, serverDSN, db.name, db.createCharset, db.createCollation); err != nil {
 		return fmt.Errorf("creating database: %w", err)
 	}
 
-	return nil
-}
-
-func dropExistingDatabaseIfExist(dsn, dbName string) error {
-	db, err := sql.Open("mysql", dsn)
+	sdb, err := db.openPool()
 	if err != nil {
 		return fmt.Errorf("opening database: %w", err)
 	}
-	defer db.Close()
-
-	if err := db.Ping(); err != nil {
+	if err = sdb.Ping(); err != nil {
+		sdb.Close()
 		return fmt.Errorf("pinging database: %w", err)
 	}
+	db.swapPool(sdb)
 
-	_, err = db.Exec(`DROP DATABASE IF EXISTS ` + dbName + `;`)
-	if err != nil {
-		return fmt.Errorf("dropping database: %w", err)
+	if db.hasMigrations() {
+		if err = db.runMigrations(context.Background()); err != nil {
+			return fmt.Errorf("running migrations: %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (db *DB) runMigrations() error {
-	_, err := db.db.Exec(`
-CREATE TABLE IF NOT EXISTS __Migrations (
-	ID INT NOT NULL AUTO_INCREMENT,
-	` + "`" + `Name` + "`" + ` VARCHAR(255) NOT NULL,
-	RunAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	PRIMARY KEY(ID)
-);`)
+// createDatabaseStatement returns the statement creating the named
+// database with the given default charset and collation. Empty values
+// are omitted, leaving them to the server's defaults.
+func createDatabaseStatement(dbName, charset, collation string) (string, error) {
+	name, err := QuoteIdentifier(dbName)
 	if err != nil {
-		return fmt.Errorf("creating migrations table: %w", err)
+		return "", fmt.Errorf("quoting database name: %w", err)
 	}
 
-	var entries []fs.DirEntry
-	entries, err = fs.ReadDir(db.migrationsFS, db.migrationsDir)
-	if err != nil {
-		return fmt.Errorf("reading migrations directory: %w", err)
-	}
-
-	migrations := make([]string, 0)
-	for _, entry := range entries {
-		if entry.IsDir() || strings.ToLower(path.Ext(entry.Name())) != ".sql" {
-			continue
+	stmt := `CREATE DATABASE IF NOT EXISTS ` + name
+	if charset != "" {
+		if !isKeyword(charset) {
+			return "", fmt.Errorf("invalid charset: %s", charset)
 		}
-
-		migrations = append(migrations, entry.Name())
+		stmt += ` CHARACTER SET ` + charset
 	}
-
-	sort.Strings(migrations)
-
-	for _, migration := range migrations {
-		var exists Bool
-		row := db.db.QueryRow("SELECT COALESCE((SELECT b'1' FROM __Migrations WHERE `Name` = ?), b'0');", migration)
-		if err = row.Scan(&exists); err != nil {
-			return fmt.Errorf("querying for migration: %w", err)
+	if collation != "" {
+		if !isKeyword(collation) {
+			return "", fmt.Errorf("invalid collation: %s", collation)
 		}
+		stmt += ` COLLATE ` + collation
+	}
+	return stmt + `;`, nil
+}
 
-		if exists {
-			continue
-		}
+// createDatabaseIfNotExist creates the database unless it exists already,
+// and reports whether it was created. MySQL reports one row affected when
+// the database is created, and none when it already exists.
+func createDatabaseIfNotExist(driverName, dsn, dbName, charset, collation string) (bool, error) {
+	stmt, err := createDatabaseStatement(dbName, charset, collation)
+	if err != nil {
+		return false, err
+	}
 
-		p := path.Join(db.migrationsDir, migration)
-		s, err := fs.ReadFile(db.migrationsFS, p)
-		if err != nil {
-			return fmt.Errorf("reading file %s: %w", p, err)
-		}
-		sql := strings.TrimSpace(string(s))
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return false, fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
 
-		delim := ";"
-		for sql != "" {
-			nextDelimIndex := strings.Index(sql, delim)
-			nextDelimChangeIndex := strings.Index(sql, "delimiter ")
+	if err := db.Ping(); err != nil {
+		return false, fmt.Errorf("pinging database: %w", err)
+	}
 
-			if nextDelimIndex == -1 && nextDelimChangeIndex == -1 {
-				return fmt.Errorf("unexpected end of migration: %s", migration)
-			}
+	res, err := db.Exec(stmt)
+	if err != nil {
+		return false, fmt.Errorf("creating database: %w", err)
+	}
 
-			if nextDelimChangeIndex == -1 || (nextDelimIndex != -1 && nextDelimIndex < nextDelimChangeIndex) {
-				var stmt string
-				// only include the delimiter if it's a semi-colon
-				if delim == ";" {
-					stmt = sql[:nextDelimIndex+1]
-				} else {
-					stmt = sql[:nextDelimIndex]
-				}
-
-				if _, err = db.db.Exec(stmt); err != nil {
-					return fmt.Errorf("executing migration statement: %w", err)
-				}
-
-				if len(sql) <= nextDelimIndex {
-					break
-				}
-				sql = strings.TrimSpace(sql[nextDelimIndex+1:])
-
-				continue
-			}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("reading rows affected: %w", err)
+	}
+	return n > 0, nil
+}
 
-			delimLineEndIndex := strings.Index(sql, "\n")
-			if delimLineEndIndex == -1 {
-				// there's nothing after this delimiter change, so we're done with the script
-				break
-			}
+func dropExistingDatabaseIfExist(driverName, dsn, dbName string) error {
+	name, err := QuoteIdentifier(dbName)
+	if err != nil {
+		return fmt.Errorf("quoting database name: %w", err)
+	}
 
-			delim = strings.Replace(sql[:delimLineEndIndex+1], "delimiter ", "", 1)
-			delim = strings.Replace(delim, "\n", "", -1)
-			delim = strings.TrimSpace(delim)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer db.Close()
 
-			// advance the sql past the delimiter change statement since the client will
-			// only handle this correctly without it, or break if it's the end of the script
-			if len(sql) <= delimLineEndIndex {
-				break
-			}
-			sql = strings.TrimSpace(sql[delimLineEndIndex+1:])
-		}
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("pinging database: %w", err)
+	}
 
-		_, err = db.db.Exec("INSERT INTO __Migrations(`Name`) VALUES (?);", migration)
-		if err != nil {
-			return fmt.Errorf("inserting migration record '%s': %w", migration, err)
-		}
+	_, err = db.Exec(`DROP DATABASE IF EXISTS ` + name + `;`)
+	if err != nil {
+		return fmt.Errorf("dropping database: %w", err)
 	}
 
 	return nil
@@ -357,18 +631,25 @@ func NewNullTime(t *time.Time) sql.NullTime {
 	return sql.NullTime{Valid: true, Time: *t}
 }
 
+// Bool is a bool scanned from a BIT(1) value, or from an integer such as
+// the result of EXISTS.
 type Bool bool
 
 func (b *Bool) Scan(src interface{}) error {
+	if n, ok := src.(int64); ok {
+		*b = n != 0
+		return nil
+	}
+
 	tmp, ok := src.([]uint8)
 	if !ok {
 		return fmt.Errorf("unexpected type for mysqlBool: %T", src)
 	}
 	switch string(tmp) {
-	case "\x00":
+	case "\x00", "0":
 		v := Bool(false)
 		*b = v
-	case "\x01":
+	case "\x01", "1":
 		v := Bool(true)
 		*b = v
 	}
@@ -381,3 +662,25 @@ func (b Bool) Value() interface{} {
 	}
 	return []uint8("\x00")
 }
+
+// errorList is several errors reported together, such as the failures
+// of an operation on several tables.
+type errorList []error
+
+func (e errorList) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target.
+func (e errorList) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,16 @@
 package mysqldb
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
 	"testing"
 	"testing/fstest"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAutoCreateDBOption(t *testing.T) {
@@ -36,3 +42,255 @@ func TestDropDBOnCloseOption(t *testing.T) {
 	DropDBOnClose()(db)
 	assert.True(t, db.dropOnClose)
 }
+
+func TestTxBeginner(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	var c Conn = db
+	beginner, ok := c.(TxBeginner)
+	require.True(t, ok)
+
+	tx, err := beginner.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	c = tx
+	_, ok = c.(TxBeginner)
+	assert.False(t, ok)
+}
+
+func TestNoDefaultDatabaseOption(t *testing.T) {
+	db := &DB{}
+	WithNoDefaultDatabase()(db)
+	assert.True(t, db.noDefaultDatabase)
+}
+
+func TestNewDBRequiresDatabaseName(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	_, err := NewDB(srv.dsn(""), withFakeDriver())
+	assert.ErrorIs(t, err, ErrNoDatabaseName)
+	assert.Zero(t, srv.connections())
+}
+
+func TestNewDBWithNoDefaultDatabase(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn(""), withFakeDriver(), WithNoDefaultDatabase())
+	require.NoError(t, err)
+	assert.NoError(t, db.Close())
+}
+
+func TestName(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn("app"), withFakeDriver())
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg, err := mysql.ParseDSN(srv.dsn("app"))
+	require.NoError(t, err)
+	assert.Equal(t, cfg.DBName, db.Name())
+	assert.Equal(t, "app", db.Name())
+}
+
+func TestWithCreateCharsetOption(t *testing.T) {
+	db := &DB{}
+	WithCreateCharset("latin1", "latin1_swedish_ci")(db)
+	assert.Equal(t, "latin1", db.createCharset)
+	assert.Equal(t, "latin1_swedish_ci", db.createCollation)
+}
+
+func TestCreateDatabaseStatement(t *testing.T) {
+	stmt, err := createDatabaseStatement("app", "utf8mb4", "utf8mb4_unicode_ci")
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE DATABASE IF NOT EXISTS `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;", stmt)
+
+	stmt, err = createDatabaseStatement("app", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE DATABASE IF NOT EXISTS `app`;", stmt)
+
+	_, err = createDatabaseStatement("app", "utf8mb4; DROP DATABASE app", "")
+	assert.Error(t, err)
+}
+
+func TestAutoCreateDBDefaultCharset(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), AutoCreateDB())
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Contains(t, srv.queries(), "CREATE DATABASE IF NOT EXISTS `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;")
+}
+
+// createDatabaseHandler reports the database as created, with one row
+// affected, unless exists is true. Every other query is handled by state.
+func createDatabaseHandler(exists bool, state *fakeMigrationState) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		if strings.HasPrefix(q.query, "CREATE DATABASE IF NOT EXISTS") {
+			if exists {
+				return fakeResult{}, nil
+			}
+			return fakeResult{affected: 1}, nil
+		}
+		return state.handle(q)
+	}
+}
+
+func TestOnCreate(t *testing.T) {
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, createDatabaseHandler(false, state))
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+
+	calls := 0
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), AutoCreateDB(), WithMigrations(fsys, "migrations"),
+		WithOnCreate(func(c Conn) error {
+			calls++
+			_, err := c.Exec("GRANT SELECT ON app.* TO 'reader'@'%';")
+			return err
+		}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{
+		"GRANT SELECT ON app.* TO 'reader'@'%';",
+		"CREATE TABLE users (ID INT);",
+	}, state.executedStatements(), "runs before migrations")
+}
+
+func TestOnCreateExistingDatabase(t *testing.T) {
+	srv := newFakeServer(t, createDatabaseHandler(true, newFakeMigrationState()))
+
+	calls := 0
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), AutoCreateDB(), WithOnCreate(func(Conn) error {
+		calls++
+		return nil
+	}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	assert.Zero(t, calls)
+}
+
+func TestOnCreateError(t *testing.T) {
+	srv := newFakeServer(t, createDatabaseHandler(false, newFakeMigrationState()))
+	hookErr := errors.New("grant failed")
+
+	_, err := NewDB(srv.dsn("app"), withFakeDriver(), AutoCreateDB(), WithOnCreate(func(Conn) error {
+		return hookErr
+	}))
+	assert.ErrorIs(t, err, hookErr)
+}
+
+func TestPingError(t *testing.T) {
+	cfg, err := mysql.ParseDSN("app:secret@tcp(db.internal:3307)/app")
+	require.NoError(t, err)
+
+	refused := errors.New("dial tcp 10.0.0.5:3307: connect: connection refused")
+	err = pingError(refused, cfg)
+	assert.ErrorIs(t, err, refused)
+	assert.Contains(t, err.Error(), "is MySQL reachable at db.internal:3307?")
+	assert.NotContains(t, err.Error(), "secret")
+
+	denied := &mysql.MySQLError{Number: 1045, Message: "Access denied for user 'app'@'10.0.0.1' (using password: YES)"}
+	err = pingError(denied, cfg)
+	assert.ErrorIs(t, err, denied)
+	assert.Contains(t, err.Error(), "db.internal:3307")
+	assert.Contains(t, err.Error(), `access denied for user "app"`)
+	assert.NotContains(t, err.Error(), "reachable")
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestNewDBWrapsPingError(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	refused := errors.New("connection refused")
+	srv.ping = func() error { return refused }
+
+	_, err := NewDB(srv.dsn("app"), withFakeDriver())
+	assert.ErrorIs(t, err, refused)
+	assert.Contains(t, err.Error(), "is MySQL reachable at")
+}
+
+func TestRowsColumns(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "name"},
+			types:   []string{"INT", "VARCHAR"},
+			rows:    [][]driver.Value{{int64(1), "gavin"}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT id, name FROM users;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, columns)
+
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	require.Len(t, types, 2)
+	assert.Equal(t, "VARCHAR", types[1].DatabaseTypeName())
+}
+
+func TestRecreate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+
+	state := newFakeMigrationState()
+	users := 0
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(q.query, "DROP DATABASE"):
+			state.applied, users = nil, 0
+		case strings.HasPrefix(q.query, "INSERT INTO users"):
+			users++
+		case strings.HasPrefix(q.query, "SELECT COUNT(*) FROM users"):
+			return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(users)}}}, nil
+		}
+		return state.handle(q)
+	})
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("INSERT INTO users VALUES (1);")
+	require.NoError(t, err)
+	state.executedStatements()
+
+	require.NoError(t, db.Recreate())
+	assert.Equal(t, []string{
+		"DROP DATABASE IF EXISTS `app`;",
+		"CREATE DATABASE IF NOT EXISTS `app` CHARACTER SET utf8mb4 COLLATE utf8mb4_unicode_ci;",
+		"CREATE TABLE users (ID INT);",
+	}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users;").Scan(&n))
+	assert.Zero(t, n)
+}
+
+func TestBoolScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want bool
+	}{
+		{[]byte("\x00"), false},
+		{[]byte("\x01"), true},
+		{[]byte("0"), false},
+		{[]byte("1"), true},
+		{int64(0), false},
+		{int64(1), true},
+	}
+	for _, test := range tests {
+		var b Bool
+		require.NoError(t, b.Scan(test.src))
+		assert.Equal(t, test.want, bool(b), "%q", test.src)
+	}
+}
@@ -0,0 +1,110 @@
+package mysqldb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// WithSessionTimeZone returns an option that will configure every
+// connection to use loc as its session time_zone, and the driver to use
+// loc for the time.Time values it parses and sends. Keeping the two in
+// step avoids times being shifted when parseTime is enabled. Locations
+// other than UTC are referenced by name, which requires the server's
+// time zone tables to be loaded.
+func WithSessionTimeZone(loc *time.Location) Option {
+	return func(db *DB) {
+		db.configureDSN = append(db.configureDSN, func(cfg *mysql.Config) error {
+			if loc == nil {
+				return errors.New("session time zone is nil")
+			}
+
+			tz := loc.String()
+			switch {
+			case loc == time.UTC:
+				tz = "+00:00"
+			case loc == time.Local:
+				return errors.New("session time zone must be a named location, not time.Local")
+			}
+
+			if cfg.Params == nil {
+				cfg.Params = map[string]string{}
+			}
+			cfg.Params["time_zone"] = "'" + tz + "'"
+			cfg.Loc = loc
+			return nil
+		})
+	}
+}
+
+// WithVerifiedTLS returns an option that will configure the DB to connect
+// using TLS, verifying the server's certificate against the system roots.
+// It's an error to combine it with a DSN using tls=skip-verify.
+func WithVerifiedTLS() Option {
+	return func(db *DB) {
+		db.configureDSN = append(db.configureDSN, func(cfg *mysql.Config) error {
+			if cfg.TLSConfig == "skip-verify" {
+				return errors.New("verified tls conflicts with tls=skip-verify in the dsn")
+			}
+
+			cfg.TLSConfig = "true"
+			return nil
+		})
+	}
+}
+
+// WithConnAttrs returns an option that will send attrs as connection
+// attributes when connecting, alongside the driver's own, so connections
+// can be attributed to the app in performance_schema.session_connect_attrs.
+// Attributes already set in the DSN are kept. Keys must be non-empty, and
+// neither keys nor values may contain a comma or a colon, which delimit
+// attributes in the DSN.
+func WithConnAttrs(attrs map[string]string) Option {
+	return func(db *DB) {
+		db.configureDSN = append(db.configureDSN, func(cfg *mysql.Config) error {
+			keys := make([]string, 0, len(attrs))
+			for k, v := range attrs {
+				if k == "" {
+					return errors.New("connection attribute key is empty")
+				}
+				if strings.ContainsAny(k, ",:") || strings.ContainsAny(v, ",:") {
+					return fmt.Errorf("connection attribute %q contains a comma or colon", k)
+				}
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			pairs := make([]string, 0, len(keys)+1)
+			if cfg.ConnectionAttributes != "" {
+				pairs = append(pairs, cfg.ConnectionAttributes)
+			}
+			for _, k := range keys {
+				pairs = append(pairs, k+":"+attrs[k])
+			}
+			cfg.ConnectionAttributes = strings.Join(pairs, ",")
+
+			// FormatDSN doesn't write ConnectionAttributes, but ParseDSN
+			// reads the parameter back into it rather than Params
+			if cfg.Params == nil {
+				cfg.Params = map[string]string{}
+			}
+			cfg.Params["connectionAttributes"] = cfg.ConnectionAttributes
+			return nil
+		})
+	}
+}
+
+// Config returns the connection settings parsed from the DB's DSN,
+// including any changes made to it by options. The returned config
+// includes the password, so take care not to log it.
+func (db *DB) Config() (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(db.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing dsn: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,102 @@
+package mysqldb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSessionTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn("test")+"?parseTime=true", withFakeDriver(), WithSessionTimeZone(loc))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg, err := mysql.ParseDSN(srv.lastDSN())
+	require.NoError(t, err)
+	assert.Equal(t, "'America/New_York'", cfg.Params["time_zone"])
+	assert.Equal(t, loc.String(), cfg.Loc.String())
+	assert.True(t, cfg.ParseTime)
+}
+
+func TestWithSessionTimeZoneUTC(t *testing.T) {
+	cfg := mysql.NewConfig()
+	db := &DB{}
+	WithSessionTimeZone(time.UTC)(db)
+	require.Len(t, db.configureDSN, 1)
+	require.NoError(t, db.configureDSN[0](cfg))
+	assert.Equal(t, "'+00:00'", cfg.Params["time_zone"])
+	assert.Equal(t, time.UTC, cfg.Loc)
+}
+
+func TestWithSessionTimeZoneLocal(t *testing.T) {
+	db := &DB{}
+	WithSessionTimeZone(time.Local)(db)
+	assert.Error(t, db.configureDSN[0](mysql.NewConfig()))
+}
+
+func TestWithVerifiedTLS(t *testing.T) {
+	cfg, err := mysql.ParseDSN("root@tcp(localhost:3306)/test")
+	require.NoError(t, err)
+
+	db := &DB{}
+	WithVerifiedTLS()(db)
+	require.NoError(t, db.configureDSN[0](cfg))
+	assert.Contains(t, cfg.FormatDSN(), "tls=true")
+}
+
+func TestWithVerifiedTLSConflict(t *testing.T) {
+	_, err := NewDB("root@tcp(localhost:3306)/test?tls=skip-verify", WithVerifiedTLS())
+	assert.ErrorContains(t, err, "skip-verify")
+}
+
+func TestWithConnAttrs(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn("test")+"?connectionAttributes=team:orders", withFakeDriver(),
+		WithConnAttrs(map[string]string{"program_name": "orders-api", "host": "web-1"}))
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg, err := mysql.ParseDSN(srv.lastDSN())
+	require.NoError(t, err)
+	assert.Equal(t, "team:orders,host:web-1,program_name:orders-api", cfg.ConnectionAttributes)
+	assert.NotContains(t, cfg.Params, "connectionAttributes")
+
+	cfg, err = db.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "team:orders,host:web-1,program_name:orders-api", cfg.ConnectionAttributes)
+}
+
+func TestWithConnAttrsInvalid(t *testing.T) {
+	for _, attrs := range []map[string]string{
+		{"": "orders-api"},
+		{"program:name": "orders-api"},
+		{"program_name": "orders,api"},
+		{"program_name": "orders:api"},
+	} {
+		db := &DB{}
+		WithConnAttrs(attrs)(db)
+		assert.Error(t, db.configureDSN[0](mysql.NewConfig()), "%v", attrs)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB("app:secret@tcp("+srv.addr+")/orders?parseTime=true", withFakeDriver())
+	require.NoError(t, err)
+	defer db.Close()
+
+	cfg, err := db.Config()
+	require.NoError(t, err)
+	assert.Equal(t, "orders", cfg.DBName)
+	assert.Equal(t, srv.addr, cfg.Addr)
+	assert.Equal(t, "app", cfg.User)
+	assert.Equal(t, "secret", cfg.Passwd)
+	assert.True(t, cfg.ParseTime)
+}
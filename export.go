@@ -0,0 +1,301 @@
+package mysqldb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportCSV runs query against c and streams the result to w as CSV, with
+// a header row of the column names. NULLs are written as empty fields.
+// Rows are written as they're read, so the result is never buffered in
+// full, and the export stops early if ctx is cancelled. The query itself
+// is run with ctx if c supports it.
+func ExportCSV(ctx context.Context, c Conn, w io.Writer, query string, args ...interface{}) error {
+	var (
+		rows Rows
+		err  error
+	)
+	if qc, ok := c.(rowsQueryerContext); ok {
+		rows, err = qc.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = c.Query(query, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err = cw.Write(columns); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+
+	for rows.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		for i, v := range values {
+			record[i] = formatText(v)
+		}
+		if err = cw.Write(record); err != nil {
+			return fmt.Errorf("writing row: %w", err)
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// StreamNDJSON runs query against c and streams the result to w as
+// newline-delimited JSON, with one object per row keyed by column name
+// in column order. Values are converted as by ScanRowToMap, then encoded
+// with encoding/json, so binary strings are base64 encoded and NULLs are
+// null. Rows are written as they're read, so the result is never
+// buffered in full, and the export stops early if ctx is cancelled. The
+// query itself is run with ctx if c supports it.
+func StreamNDJSON(ctx context.Context, c Conn, w io.Writer, query string, args ...interface{}) error {
+	var (
+		rows Rows
+		err  error
+	)
+	if qc, ok := c.(rowsQueryerContext); ok {
+		rows, err = qc.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = c.Query(query, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return err
+	}
+	types, err := rowColumnTypes(rows, columns)
+	if err != nil {
+		return err
+	}
+
+	keys := make([][]byte, len(columns))
+	for i, column := range columns {
+		if keys[i], err = json.Marshal(column); err != nil {
+			return fmt.Errorf("encoding column %s: %w", column, err)
+		}
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	var line bytes.Buffer
+	for rows.Next() {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+
+		line.Reset()
+		line.WriteByte('{')
+		for i, v := range values {
+			if v, err = convertColumn(v, types[i]); err != nil {
+				return fmt.Errorf("converting column %s: %w", columns[i], err)
+			}
+			value, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("encoding column %s: %w", columns[i], err)
+			}
+
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			line.Write(keys[i])
+			line.WriteByte(':')
+			line.Write(value)
+		}
+		line.WriteString("}\n")
+
+		if _, err = w.Write(line.Bytes()); err != nil {
+			return fmt.Errorf("writing row: %w", err)
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+	return nil
+}
+
+// formatText formats a scanned column value as text, with NULL as empty.
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(v)
+}
+
+// DumpData writes an INSERT statement for every row of the given tables,
+// or of every table other than the DB's bookkeeping tables if none are
+// given, to w. Values are written as literals for their column's type,
+// with NULLs as NULL. Non-empty strings are written as hex literals, so
+// no value can be mistaken for a delimiter or a delimiter change when
+// the output is loaded with LoadSchema. The statements are wrapped in
+// SET FOREIGN_KEY_CHECKS, so tables can be loaded in any order. It's
+// meant for small datasets, such as test fixtures, rather than as a
+// replacement for mysqldump.
+func (db *DB) DumpData(w io.Writer, tables ...string) error {
+	if len(tables) == 0 {
+		var err error
+		if tables, err = db.userTables(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "SET FOREIGN_KEY_CHECKS = 0;\n"); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+	for _, table := range tables {
+		if err := db.dumpTable(w, table); err != nil {
+			return fmt.Errorf("dumping table %s: %w", table, err)
+		}
+	}
+	if _, err := io.WriteString(w, "SET FOREIGN_KEY_CHECKS = 1;\n"); err != nil {
+		return fmt.Errorf("writing footer: %w", err)
+	}
+	return nil
+}
+
+// dumpTable writes an INSERT statement for every row of table to w.
+func (db *DB) dumpTable(w io.Writer, table string) error {
+	quoted, err := QuoteIdentifier(table)
+	if err != nil {
+		return err
+	}
+	qualified, err := db.qualifyTable(table)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT * FROM " + qualified + ";")
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return err
+	}
+	types, err := rowColumnTypes(rows, columns)
+	if err != nil {
+		return err
+	}
+	quotedColumns, err := quoteIdentifiers(columns)
+	if err != nil {
+		return err
+	}
+	prefix := "INSERT INTO " + quoted + " (" + strings.Join(quotedColumns, ", ") + ") VALUES ("
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	literals := make([]string, len(columns))
+
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		for i, v := range values {
+			if literals[i], err = sqlLiteral(v, types[i]); err != nil {
+				return fmt.Errorf("formatting column %s: %w", columns[i], err)
+			}
+		}
+		if _, err = io.WriteString(w, prefix+strings.Join(literals, ", ")+");\n"); err != nil {
+			return fmt.Errorf("writing row: %w", err)
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("reading rows: %w", err)
+	}
+	return nil
+}
+
+// sqlLiteral formats a value scanned from a column of the given database
+// type as a SQL literal.
+func sqlLiteral(v interface{}, typeName string) (string, error) {
+	if b, ok := v.([]byte); ok && typeName == "DECIMAL" {
+		return string(b), nil
+	}
+
+	v, err := convertColumn(v, typeName)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case time.Time:
+		if v.IsZero() {
+			return "'0000-00-00 00:00:00'", nil
+		}
+		if typeName == "DATE" {
+			return "'" + v.Format("2006-01-02") + "'", nil
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case string:
+		if v == "" {
+			return "''", nil
+		}
+		return "_utf8mb4 X'" + hex.EncodeToString([]byte(v)) + "'", nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
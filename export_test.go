@@ -0,0 +1,130 @@
+package mysqldb
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usersHandler(q fakeQuery) (fakeResult, error) {
+	return fakeResult{
+		columns: []string{"id", "name", "email"},
+		types:   []string{"INT", "VARCHAR", "VARCHAR"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("gavin"), []byte("g@example.com")},
+			{int64(2), []byte("o'brien, pat"), nil},
+		},
+	}, nil
+}
+
+func TestExportCSV(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	var buf bytes.Buffer
+	require.NoError(t, ExportCSV(context.Background(), db, &buf, "SELECT id, name, email FROM users;"))
+	assert.Equal(t, "id,name,email\n1,gavin,g@example.com\n2,\"o'brien, pat\",\n", buf.String())
+}
+
+func TestExportCSVCancelled(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	assert.ErrorIs(t, ExportCSV(ctx, db, &buf, "SELECT id, name, email FROM users;"), context.Canceled)
+	assert.Empty(t, srv.queries(), "the query isn't run")
+	assert.Empty(t, buf.String())
+}
+
+func TestStreamNDJSON(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	var buf bytes.Buffer
+	require.NoError(t, StreamNDJSON(context.Background(), db, &buf, "SELECT id, name, email FROM users;"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Equal(t, []string{
+		`{"id":1,"name":"gavin","email":"g@example.com"}`,
+		`{"id":2,"name":"o'brien, pat","email":null}`,
+	}, lines)
+	for _, line := range lines {
+		var row map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &row))
+	}
+}
+
+func TestStreamNDJSONCancelled(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	assert.ErrorIs(t, StreamNDJSON(ctx, db, &buf, "SELECT id, name, email FROM users;"), context.Canceled)
+	assert.Empty(t, srv.queries(), "the query isn't run")
+	assert.Empty(t, buf.String())
+}
+
+func TestDumpData(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.Contains(q.query, "information_schema.TABLES"):
+			return fakeResult{columns: []string{"TABLE_NAME"}, rows: [][]driver.Value{{"__Migrations"}, {"items"}}}, nil
+		case q.query == "SELECT * FROM `items`;":
+			return fakeResult{
+				columns: []string{"id", "name", "price", "weight", "added", "data", "note"},
+				types:   []string{"INT", "VARCHAR", "DECIMAL", "DOUBLE", "DATETIME", "BLOB", "TEXT"},
+				rows: [][]driver.Value{
+					{int64(1), []byte("it's a \"widget\"\\"), []byte("9.99"), []byte("1.5"), []byte("2023-01-02 03:04:05"), []byte{0x00, 0xff}, []byte("line 1\nline 2")},
+					{int64(2), []byte("a; b"), nil, nil, nil, nil, []byte("x\ndelimiter //\n")},
+					{int64(3), []byte(""), nil, nil, nil, nil, nil},
+				},
+			}, nil
+		}
+		return fakeResult{}, errors.New("unexpected query: " + q.query)
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+
+	var buf bytes.Buffer
+	require.NoError(t, db.DumpData(&buf))
+	statements := []string{
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		"INSERT INTO `items` (`id`, `name`, `price`, `weight`, `added`, `data`, `note`) VALUES (1, _utf8mb4 X'6974277320612022776964676574225c', 9.99, 1.5, '2023-01-02 03:04:05', X'00ff', _utf8mb4 X'6c696e6520310a6c696e652032');",
+		"INSERT INTO `items` (`id`, `name`, `price`, `weight`, `added`, `data`, `note`) VALUES (2, _utf8mb4 X'613b2062', NULL, NULL, NULL, NULL, _utf8mb4 X'780a64656c696d69746572202f2f0a');",
+		"INSERT INTO `items` (`id`, `name`, `price`, `weight`, `added`, `data`, `note`) VALUES (3, '', NULL, NULL, NULL, NULL, NULL);",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+	}
+	assert.Equal(t, strings.Join(statements, "\n")+"\n", buf.String())
+	assert.NotContains(t, srv.queries(), "SELECT * FROM `__Migrations`;")
+
+	dst := newFakeServer(t, nil)
+	fresh := &DB{db: dst.open(t), name: "fresh"}
+	require.NoError(t, fresh.LoadSchema(buf.String()))
+	loaded := append([]string{"SET FOREIGN_KEY_CHECKS = 0;"}, statements...)
+	assert.Equal(t, append(loaded, "SET FOREIGN_KEY_CHECKS = 1;"), dst.queries())
+}
+
+func TestDumpDataTables(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t), name: "test"}
+
+	var buf bytes.Buffer
+	require.NoError(t, db.DumpData(&buf, "users"))
+	assert.Equal(t, "SET FOREIGN_KEY_CHECKS = 0;\n"+
+		"INSERT INTO `users` (`id`, `name`, `email`) VALUES (1, _utf8mb4 X'676176696e', _utf8mb4 X'67406578616d706c652e636f6d');\n"+
+		"INSERT INTO `users` (`id`, `name`, `email`) VALUES (2, _utf8mb4 X'6f27627269656e2c20706174', NULL);\n"+
+		"SET FOREIGN_KEY_CHECKS = 1;\n", buf.String())
+	assert.Equal(t, []string{"SELECT * FROM `users`;"}, srv.queries())
+
+	assert.Error(t, db.DumpData(&buf, "users "))
+}
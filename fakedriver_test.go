@@ -0,0 +1,291 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const fakeDriverName = "mysqldb-fake"
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+}
+
+var (
+	fakeServersMu sync.Mutex
+	fakeServers   = map[string]*fakeServer{}
+	fakeServerSeq int64
+)
+
+// withFakeDriver returns an option that will configure the DB to connect
+// through the fake driver, so NewDB connects to a fakeServer.
+func withFakeDriver() Option {
+	return func(db *DB) {
+		db.driverName = fakeDriverName
+	}
+}
+
+// fakeQuery is a statement received by a fakeServer. conn identifies the
+// connection it was received on, numbered from 1 in the order opened.
+type fakeQuery struct {
+	ctx   context.Context
+	conn  int
+	query string
+	args  []driver.Value
+}
+
+// fakeResult is a scripted response to a fakeQuery. Exec calls use
+// affected and insertID, while Query calls use columns, types, and rows.
+type fakeResult struct {
+	columns  []string
+	types    []string
+	rows     [][]driver.Value
+	affected int64
+	insertID int64
+}
+
+// fakeServer stands in for a MySQL server in tests. Every statement it
+// receives is recorded and answered by its handler.
+type fakeServer struct {
+	addr    string
+	handler func(q fakeQuery) (fakeResult, error)
+	ping    func() error
+
+	mu    sync.Mutex
+	log   []string
+	dsns  []string
+	conns int
+}
+
+// newFakeServer registers a fakeServer answering queries with handler.
+// A nil handler answers every query with an empty result.
+func newFakeServer(t testing.TB, handler func(q fakeQuery) (fakeResult, error)) *fakeServer {
+	t.Helper()
+	if handler == nil {
+		handler = func(fakeQuery) (fakeResult, error) { return fakeResult{}, nil }
+	}
+
+	s := &fakeServer{
+		addr:    fmt.Sprintf("fake-%d:3306", atomic.AddInt64(&fakeServerSeq, 1)),
+		handler: handler,
+	}
+
+	fakeServersMu.Lock()
+	fakeServers[s.addr] = s
+	fakeServersMu.Unlock()
+	t.Cleanup(func() {
+		fakeServersMu.Lock()
+		delete(fakeServers, s.addr)
+		fakeServersMu.Unlock()
+	})
+
+	return s
+}
+
+// dsn returns a DSN that connects to the server with the given database name.
+func (s *fakeServer) dsn(dbName string) string {
+	return "root@tcp(" + s.addr + ")/" + dbName
+}
+
+// open returns a sql.DB connected to the server.
+func (s *fakeServer) open(t testing.TB) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(fakeDriverName, s.dsn("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// queries returns every statement the server has received, in order.
+func (s *fakeServer) queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.log...)
+}
+
+// lastDSN returns the DSN most recently used to connect to the server.
+func (s *fakeServer) lastDSN() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dsns) == 0 {
+		return ""
+	}
+	return s.dsns[len(s.dsns)-1]
+}
+
+// connections returns the number of connections opened to the server.
+func (s *fakeServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *fakeServer) do(ctx context.Context, conn int, query string, args []driver.NamedValue) (fakeResult, error) {
+	s.mu.Lock()
+	s.log = append(s.log, query)
+	s.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return s.handler(fakeQuery{ctx: ctx, conn: conn, query: query, args: values})
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := fakeDriver{}.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+func (fakeDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	fakeServersMu.Lock()
+	s, ok := fakeServers[cfg.Addr]
+	fakeServersMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no fake server at %s", cfg.Addr)
+	}
+
+	s.mu.Lock()
+	s.dsns = append(s.dsns, dsn)
+	s.mu.Unlock()
+
+	return &fakeConnector{server: s}, nil
+}
+
+type fakeConnector struct {
+	server *fakeServer
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	c.server.mu.Lock()
+	c.server.conns++
+	id := c.server.conns
+	c.server.mu.Unlock()
+	return &fakeConn{server: c.server, id: id}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeConn struct {
+	server *fakeServer
+	id     int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.server.do(ctx, c.id, "BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) Ping(context.Context) error {
+	if c.server.ping != nil {
+		return c.server.ping()
+	}
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.server.do(ctx, c.id, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return fakeDriverResult{res}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.server.do(ctx, c.id, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{res: res}, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	_, err := tx.conn.server.do(context.Background(), tx.conn.id, "COMMIT", nil)
+	return err
+}
+
+func (tx *fakeTx) Rollback() error {
+	_, err := tx.conn.server.do(context.Background(), tx.conn.id, "ROLLBACK", nil)
+	return err
+}
+
+type fakeDriverResult struct {
+	res fakeResult
+}
+
+func (r fakeDriverResult) LastInsertId() (int64, error) {
+	return r.res.insertID, nil
+}
+
+func (r fakeDriverResult) RowsAffected() (int64, error) {
+	return r.res.affected, nil
+}
+
+type fakeRows struct {
+	res fakeResult
+	pos int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.res.columns
+}
+
+func (r *fakeRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index >= len(r.res.types) {
+		return ""
+	}
+	return r.res.types[index]
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.res.rows) {
+		return io.EOF
+	}
+	copy(dest, r.res.rows[r.pos])
+	r.pos++
+	return nil
+}
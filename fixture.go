@@ -0,0 +1,29 @@
+package mysqldb
+
+import (
+	"context"
+	"testing"
+)
+
+// RunInRollbackTx runs fn in a transaction that is always rolled back, so
+// each test leaves nothing behind in the database. The test fails if the
+// transaction can't be started or rolled back. fn must not commit.
+//
+// This is the only file in the package importing testing. Since Go 1.13
+// the testing package doesn't register its flags until tests run, so
+// importing it doesn't affect non-test binaries beyond their size.
+func (db *DB) RunInRollbackTx(t testing.TB, fn func(tx *Tx)) {
+	t.Helper()
+
+	tx, err := db.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("beginning transaction: %v", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("rolling back transaction: %v", err)
+		}
+	}()
+
+	fn(tx)
+}
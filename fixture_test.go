@@ -0,0 +1,55 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// txRowsHandler simulates a table of rows that are only kept once the
+// transaction inserting them commits. It answers SELECT COUNT(*) with
+// the number of rows visible to the querying connection.
+func txRowsHandler() func(q fakeQuery) (fakeResult, error) {
+	var mu sync.Mutex
+	committed := 0
+	staged := map[int]int{}
+
+	return func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case strings.HasPrefix(q.query, "INSERT"):
+			staged[q.conn]++
+		case q.query == "COMMIT":
+			committed += staged[q.conn]
+			delete(staged, q.conn)
+		case q.query == "ROLLBACK":
+			delete(staged, q.conn)
+		case strings.HasPrefix(q.query, "SELECT COUNT(*)"):
+			return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(committed + staged[q.conn])}}}, nil
+		}
+		return fakeResult{}, nil
+	}
+}
+
+func TestRunInRollbackTx(t *testing.T) {
+	srv := newFakeServer(t, txRowsHandler())
+	db := &DB{db: srv.open(t)}
+
+	var n int
+	db.RunInRollbackTx(t, func(tx *Tx) {
+		_, err := tx.Exec("INSERT INTO users (name) VALUES (?);", "gavin")
+		require.NoError(t, err)
+		require.NoError(t, tx.QueryRow("SELECT COUNT(*) FROM users;").Scan(&n))
+		assert.Equal(t, 1, n)
+	})
+
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users;").Scan(&n))
+	assert.Zero(t, n)
+	assert.Contains(t, srv.queries(), "ROLLBACK")
+}
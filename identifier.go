@@ -0,0 +1,51 @@
+package mysqldb
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the maximum length, in characters, of a
+// database, table, or column name.
+const maxIdentifierLength = 64
+
+// QuoteIdentifier validates name as a MySQL identifier and returns it
+// quoted with backticks, doubling any backticks within it. Names must be
+// non-empty, at most 64 characters, must not end with a space, and must
+// not contain NUL or characters outside the Basic Multilingual Plane.
+func QuoteIdentifier(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("identifier is empty")
+	}
+	if !utf8.ValidString(name) {
+		return "", errors.New("identifier is not valid UTF-8")
+	}
+	if utf8.RuneCountInString(name) > maxIdentifierLength {
+		return "", errors.New("identifier is longer than 64 characters: " + name)
+	}
+	if strings.HasSuffix(name, " ") {
+		return "", errors.New("identifier ends with a space: " + name)
+	}
+	for _, r := range name {
+		if r == 0 || r > 0xFFFF {
+			return "", errors.New("identifier contains an invalid character: " + name)
+		}
+	}
+
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`", nil
+}
+
+// isKeyword reports whether s is a non-empty run of letters, digits, and
+// underscores, such as a charset or collation name.
+func isKeyword(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package mysqldb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	q, err := QuoteIdentifier("users")
+	require.NoError(t, err)
+	assert.Equal(t, "`users`", q)
+
+	q, err = QuoteIdentifier("my table")
+	require.NoError(t, err)
+	assert.Equal(t, "`my table`", q)
+}
+
+func TestQuoteIdentifierEmbeddedBackticks(t *testing.T) {
+	q, err := QuoteIdentifier("we`ird")
+	require.NoError(t, err)
+	assert.Equal(t, "`we``ird`", q)
+}
+
+func TestQuoteIdentifierInvalid(t *testing.T) {
+	for _, name := range []string{"", "trailing ", "nul\x00", strings.Repeat("a", 65), "emoji😀"} {
+		_, err := QuoteIdentifier(name)
+		assert.Error(t, err, name)
+	}
+}
@@ -0,0 +1,167 @@
+package mysqldb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrMigrationsLocked is returned when migrations can't be run because
+// another instance held the migration lock until the context was done.
+var ErrMigrationsLocked = errors.New("migrations are locked by another instance")
+
+// tableLockPoll is how often a held migration lock is retried.
+var tableLockPoll = 250 * time.Millisecond
+
+// WithTableLock returns an option that will configure the DB to hold a
+// lock while running migrations, so that only one instance runs them at
+// a time. The lock is a row in a __MigrationLock table rather than an
+// advisory lock, for environments where GET_LOCK isn't available. Other
+// instances wait while it's held, failing with ErrMigrationsLocked if
+// their context is done first. A lock older than ttl is considered
+// stale, e.g. left behind by an instance that died while migrating, and
+// is taken over.
+func WithTableLock(ttl time.Duration) Option {
+	return func(db *DB) {
+		db.tableLockTTL = ttl
+	}
+}
+
+// acquireTableLock takes the migration lock, clearing it first if it's
+// stale, and waiting until ctx is done while it's held. It returns the
+// random token identifying this holder, which is needed to release it.
+func (db *DB) acquireTableLock(ctx context.Context) (string, error) {
+	_, err := db.migrationsConn().Exec(`
+CREATE TABLE IF NOT EXISTS __MigrationLock (
+	ID TINYINT NOT NULL,
+	Owner CHAR(32) NOT NULL,
+	LockedAt TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+	PRIMARY KEY(ID)
+);`)
+	if err != nil {
+		return "", fmt.Errorf("creating migration lock table: %w", err)
+	}
+
+	token := make([]byte, 16)
+	if _, err = rand.Read(token); err != nil {
+		return "", fmt.Errorf("generating migration lock owner: %w", err)
+	}
+	owner := hex.EncodeToString(token)
+
+	poll := tableLockPoll
+	if db.tableLockTTL < poll {
+		poll = db.tableLockTTL
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		_, err = db.migrationsConn().Exec(
+			"DELETE FROM __MigrationLock WHERE ID = 1 AND TIMESTAMPDIFF(MICROSECOND, LockedAt, CURRENT_TIMESTAMP(6)) >= ?;",
+			db.tableLockTTL.Microseconds())
+		if err != nil {
+			return "", fmt.Errorf("clearing stale migration lock: %w", err)
+		}
+
+		_, err = db.migrationsConn().Exec("INSERT INTO __MigrationLock(ID, Owner) VALUES (1, ?);", owner)
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+			if err != nil {
+				return "", fmt.Errorf("inserting migration lock: %w", err)
+			}
+			return owner, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("%w: %v", ErrMigrationsLocked, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseTableLock releases the migration lock taken by owner. It's an
+// error if the lock was taken over in the meantime, since another
+// instance may then have run migrations at the same time.
+func (db *DB) releaseTableLock(owner string) error {
+	res, err := db.migrationsConn().Exec("DELETE FROM __MigrationLock WHERE ID = 1 AND Owner = ?;", owner)
+	if err != nil {
+		return fmt.Errorf("releasing migration lock: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("releasing migration lock: it was taken over by another instance after its ttl expired")
+	}
+	return nil
+}
+
+// GetLock tries to acquire the named advisory lock with MySQL's GET_LOCK,
+// waiting up to timeout for another session to release it. A negative
+// timeout waits indefinitely. Timeouts are rounded up to whole seconds.
+// The lock is held by the session connection, so it isn't lost when the
+// pool closes idle connections, and is held until it's released with
+// ReleaseLock or the session connection is closed. Besides Close, that
+// happens when Recreate is called and when WithAutoReconnect replaces
+// the pool, and MySQL releases the lock without notice if the
+// connection is lost, so a lock must be acquired again after any of
+// them. It reports false if the lock is held by another session for the
+// whole timeout.
+func (db *DB) GetLock(name string, timeout time.Duration) (bool, error) {
+	if err := validateLockName(name); err != nil {
+		return false, err
+	}
+
+	seconds := int64(-1)
+	if timeout >= 0 {
+		seconds = int64((timeout + time.Second - 1) / time.Second)
+	}
+
+	conn, err := db.Session()
+	if err != nil {
+		return false, err
+	}
+
+	var acquired sql.NullInt64
+	if err = conn.QueryRow("SELECT GET_LOCK(?, ?);", name, seconds).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("getting lock %s: %w", name, err)
+	}
+	if !acquired.Valid {
+		return false, fmt.Errorf("getting lock %s: an error occurred", name)
+	}
+	return acquired.Int64 == 1, nil
+}
+
+// ReleaseLock releases the named advisory lock acquired with GetLock. It
+// reports false if the lock isn't held by the DB's session, either
+// because it's held by another session or by none.
+func (db *DB) ReleaseLock(name string) (bool, error) {
+	if err := validateLockName(name); err != nil {
+		return false, err
+	}
+
+	conn, err := db.Session()
+	if err != nil {
+		return false, err
+	}
+
+	var released sql.NullInt64
+	if err = conn.QueryRow("SELECT RELEASE_LOCK(?);", name).Scan(&released); err != nil {
+		return false, fmt.Errorf("releasing lock %s: %w", name, err)
+	}
+	return released.Int64 == 1, nil
+}
+
+// validateLockName checks name is usable as an advisory lock name, which
+// MySQL limits to 64 characters.
+func validateLockName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return fmt.Errorf("invalid lock name %q: must be 1 to 64 characters", name)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTableLock simulates the __MigrationLock table, deferring all other
+// statements to the migration bookkeeping in state. The lock's age is in
+// microseconds.
+type fakeTableLock struct {
+	mu    sync.Mutex
+	held  bool
+	owner string
+	age   int64
+	state *fakeMigrationState
+
+	// inserts counts the attempts to take the lock
+	inserts int
+}
+
+func (l *fakeTableLock) handle(q fakeQuery) (fakeResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case strings.Contains(q.query, "CREATE TABLE IF NOT EXISTS __MigrationLock"):
+		return fakeResult{}, nil
+	case strings.Contains(q.query, "DELETE FROM __MigrationLock WHERE ID = 1 AND TIMESTAMPDIFF"):
+		if l.held && l.age >= q.args[0].(int64) {
+			l.held = false
+			return fakeResult{affected: 1}, nil
+		}
+		return fakeResult{}, nil
+	case strings.HasPrefix(q.query, "INSERT INTO __MigrationLock"):
+		l.inserts++
+		if l.held {
+			return fakeResult{}, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"}
+		}
+		l.held, l.owner, l.age = true, q.args[0].(string), 0
+		return fakeResult{affected: 1}, nil
+	case q.query == "DELETE FROM __MigrationLock WHERE ID = 1 AND Owner = ?;":
+		if l.held && l.owner == q.args[0].(string) {
+			l.held = false
+			return fakeResult{affected: 1}, nil
+		}
+		return fakeResult{}, nil
+	}
+
+	return l.state.handle(q)
+}
+
+// release releases the lock as if by another instance.
+func (l *fakeTableLock) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+}
+
+// attempts returns the number of attempts to take the lock.
+func (l *fakeTableLock) attempts() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inserts
+}
+
+func newTableLockTestDB(t *testing.T, lock *fakeTableLock) *DB {
+	t.Helper()
+	lock.state = newFakeMigrationState()
+	srv := newFakeServer(t, lock.handle)
+
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}, "migrations")(db)
+	WithTableLock(time.Minute)(db)
+	return db
+}
+
+func TestTableLockReleased(t *testing.T) {
+	lock := &fakeTableLock{}
+	db := newTableLockTestDB(t, lock)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.False(t, lock.held)
+	assert.Len(t, lock.owner, 32)
+	assert.Equal(t, []string{"001_users.sql"}, lock.state.applied)
+}
+
+func TestTableLockHeld(t *testing.T) {
+	lock := &fakeTableLock{held: true, owner: "other", age: (30 * time.Second).Microseconds()}
+	db := newTableLockTestDB(t, lock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*tableLockPoll/2)
+	defer cancel()
+	err := db.runMigrations(ctx)
+	assert.ErrorIs(t, err, ErrMigrationsLocked)
+	assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+	assert.True(t, lock.held)
+	assert.Equal(t, "other", lock.owner)
+	assert.GreaterOrEqual(t, lock.attempts(), 2, "retried while waiting")
+	assert.Empty(t, lock.state.applied)
+}
+
+func TestTableLockWaits(t *testing.T) {
+	lock := &fakeTableLock{held: true, owner: "other", age: (30 * time.Second).Microseconds()}
+	db := newTableLockTestDB(t, lock)
+
+	go func() {
+		time.Sleep(tableLockPoll / 2)
+		lock.release()
+	}()
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.False(t, lock.held)
+	assert.GreaterOrEqual(t, lock.attempts(), 2)
+	assert.Equal(t, []string{"001_users.sql"}, lock.state.applied)
+}
+
+func TestTableLockStale(t *testing.T) {
+	lock := &fakeTableLock{held: true, owner: "other", age: (2 * time.Minute).Microseconds()}
+	db := newTableLockTestDB(t, lock)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.False(t, lock.held)
+	assert.Equal(t, []string{"001_users.sql"}, lock.state.applied)
+}
+
+// A TTL under a second isn't truncated to zero, which would make every
+// lock stale.
+func TestTableLockSubSecondTTL(t *testing.T) {
+	lock := &fakeTableLock{held: true, owner: "other", age: (100 * time.Millisecond).Microseconds()}
+	db := newTableLockTestDB(t, lock)
+	WithTableLock(500 * time.Millisecond)(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, db.runMigrations(ctx), ErrMigrationsLocked)
+	assert.Equal(t, "other", lock.owner)
+}
+
+// Releasing the lock leaves it alone if it was taken over by another
+// instance once its TTL expired.
+func TestTableLockTakenOver(t *testing.T) {
+	lock := &fakeTableLock{}
+	db := newTableLockTestDB(t, lock)
+	WithBeforeMigrate(func(Conn) error {
+		lock.mu.Lock()
+		defer lock.mu.Unlock()
+		lock.owner = "other"
+		return nil
+	})(db)
+
+	assert.ErrorContains(t, db.runMigrations(context.Background()), "taken over")
+	assert.True(t, lock.held)
+	assert.Equal(t, "other", lock.owner)
+}
+
+// namedLocksHandler simulates GET_LOCK and RELEASE_LOCK, with each lock
+// held by the connection that acquired it. It records the timeouts given.
+func namedLocksHandler() (func(q fakeQuery) (fakeResult, error), func() []int64) {
+	var (
+		mu       sync.Mutex
+		holders  = map[string]int{}
+		timeouts []int64
+	)
+	result := func(v driver.Value) fakeResult {
+		return fakeResult{columns: []string{"result"}, rows: [][]driver.Value{{v}}}
+	}
+
+	handler := func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch q.query {
+		case "SELECT GET_LOCK(?, ?);":
+			name := q.args[0].(string)
+			timeouts = append(timeouts, q.args[1].(int64))
+			if holder, ok := holders[name]; ok && holder != q.conn {
+				return result(int64(0)), nil
+			}
+			holders[name] = q.conn
+			return result(int64(1)), nil
+		case "SELECT RELEASE_LOCK(?);":
+			name := q.args[0].(string)
+			holder, ok := holders[name]
+			if !ok {
+				return result(nil), nil
+			}
+			if holder != q.conn {
+				return result(int64(0)), nil
+			}
+			delete(holders, name)
+			return result(int64(1)), nil
+		}
+		return fakeResult{}, nil
+	}
+	recorded := func() []int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int64(nil), timeouts...)
+	}
+	return handler, recorded
+}
+
+func TestNamedLocks(t *testing.T) {
+	handler, timeouts := namedLocksHandler()
+	srv := newFakeServer(t, handler)
+	first := &DB{db: srv.open(t)}
+	second := &DB{db: srv.open(t)}
+
+	acquired, err := first.GetLock("reports", time.Second)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	// the lock is held by the session, not whichever pool connection ran
+	// the statement
+	for i := 0; i < 3; i++ {
+		_, err = first.Exec("SELECT 1;")
+		require.NoError(t, err)
+	}
+	acquired, err = first.GetLock("reports", 0)
+	require.NoError(t, err)
+	assert.True(t, acquired, "the session can re-acquire its own lock")
+
+	acquired, err = second.GetLock("reports", 1500*time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, acquired, "another session can't acquire the lock")
+	released, err := second.ReleaseLock("reports")
+	require.NoError(t, err)
+	assert.False(t, released, "another session can't release the lock")
+
+	released, err = first.ReleaseLock("reports")
+	require.NoError(t, err)
+	assert.True(t, released)
+	released, err = first.ReleaseLock("reports")
+	require.NoError(t, err)
+	assert.False(t, released, "the lock is no longer held")
+
+	acquired, err = second.GetLock("reports", -1)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	assert.Equal(t, []int64{1, 0, 2, -1}, timeouts())
+}
+
+func TestNamedLockInvalidName(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	_, err := db.GetLock("", time.Second)
+	assert.Error(t, err)
+	_, err = db.ReleaseLock(strings.Repeat("a", 65))
+	assert.Error(t, err)
+	assert.Empty(t, srv.queries())
+}
@@ -0,0 +1,150 @@
+package mysqldb
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// Logger is used by the DB to log, such as for WithSlowQueryLog. It's
+// satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger returns an option that will configure the DB to log through
+// l. The standard library's default logger is used otherwise.
+func WithLogger(l Logger) Option {
+	return func(db *DB) {
+		db.logger = l
+	}
+}
+
+// WithSlowQueryLog returns an option that will configure the DB to log
+// every statement run through it that takes longer than threshold, with
+// its SQL, duration and arguments. Arguments are redacted as configured by
+// WithArgRedactor. For queries, only the time until the first result is
+// available is measured.
+func WithSlowQueryLog(threshold time.Duration) Option {
+	return func(db *DB) {
+		db.slowQueryThreshold = threshold
+	}
+}
+
+// WithSQLRedaction returns an option that will configure the DB to
+// replace the string and numeric literals in logged SQL with ?, so values
+// inlined into queries aren't written to the logs.
+func WithSQLRedaction() Option {
+	return func(db *DB) {
+		db.redactSQL = true
+	}
+}
+
+// WithArgRedactor returns an option that will configure the DB to pass the
+// arguments of logged statements through fn before they're logged, such as
+// to keep values that aren't personal data. By default every argument is
+// logged as ****. It's separate from WithSQLRedaction, which only redacts
+// values inlined into the SQL.
+func WithArgRedactor(fn func(args []interface{}) []interface{}) Option {
+	return func(db *DB) {
+		db.argRedactor = fn
+	}
+}
+
+// redactArgs returns args as they should be logged.
+func (db *DB) redactArgs(args []interface{}) []interface{} {
+	if db.argRedactor != nil {
+		return db.argRedactor(append([]interface{}(nil), args...))
+	}
+
+	redacted := make([]interface{}, len(args))
+	for i := range redacted {
+		redacted[i] = "****"
+	}
+	return redacted
+}
+
+// logSlowQuery logs query and its args if it has run for longer than the
+// slow query threshold since start.
+func (db *DB) logSlowQuery(start time.Time, query string, args []interface{}) {
+	if db.slowQueryThreshold <= 0 {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < db.slowQueryThreshold {
+		return
+	}
+
+	if db.redactSQL {
+		query = redactSQL(query)
+	}
+	if len(args) == 0 {
+		db.log().Printf("mysqldb: slow query (%s): %s", elapsed, query)
+		return
+	}
+	db.log().Printf("mysqldb: slow query (%s): %s args: %v", elapsed, query, db.redactArgs(args))
+}
+
+// log returns the configured Logger, or the default logger if none is.
+func (db *DB) log() Logger {
+	if db.logger == nil {
+		return log.Default()
+	}
+	return db.logger
+}
+
+// redactSQL replaces the string and numeric literals in query with ?.
+// Quoted identifiers are left as they are.
+func redactSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i)
+			b.WriteByte('?')
+		case c == '`':
+			end := skipQuoted(query, i)
+			b.WriteString(query[i : end+1])
+			i = end
+		case c >= '0' && c <= '9' && (i == 0 || !isWordByte(query[i-1])):
+			for i+1 < len(query) && (isWordByte(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// skipQuoted returns the index of the quote closing the quoted string
+// starting at query[start], or the last index if it's unterminated.
+// Quotes are escaped by a backslash, except in identifiers, or doubled.
+func skipQuoted(query string, start int) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(query) - 1
+}
+
+// isWordByte reports whether c can be part of an unquoted identifier.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
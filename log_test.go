@@ -0,0 +1,116 @@
+package mysqldb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogger is a Logger that records every line logged.
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) logged() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if q.query == "SELECT SLEEP(0.05);" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return fakeResult{}, nil
+	})
+	logger := &testLogger{}
+	db := &DB{db: srv.open(t)}
+	WithLogger(logger)(db)
+	WithSlowQueryLog(20 * time.Millisecond)(db)
+
+	rows, err := db.Query("SELECT 1;")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Empty(t, logger.logged())
+
+	_, err = db.Exec("SELECT SLEEP(0.05);")
+	require.NoError(t, err)
+	lines := logger.logged()
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "slow query")
+	assert.Contains(t, lines[0], "SELECT SLEEP(0.05);")
+}
+
+func TestSlowQueryLogRedacted(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		time.Sleep(5 * time.Millisecond)
+		return fakeResult{}, nil
+	})
+	logger := &testLogger{}
+	db := &DB{db: srv.open(t)}
+	WithLogger(logger)(db)
+	WithSlowQueryLog(time.Millisecond)(db)
+	WithSQLRedaction()(db)
+
+	_, err := db.Exec("UPDATE users SET email = 'g@example.com' WHERE id = 42;")
+	require.NoError(t, err)
+	lines := logger.logged()
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "UPDATE users SET email = ? WHERE id = ?;")
+}
+
+func TestRedactSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = 1;":                     "SELECT * FROM users WHERE id = ?;",
+		`SELECT 'it''s', "a \" b", 'c\'d' FROM t;`:              "SELECT ?, ?, ? FROM t;",
+		"SELECT `col'1`, t2.c3 FROM t2 WHERE x IN (1.5, 0x1F);": "SELECT `col'1`, t2.c3 FROM t2 WHERE x IN (?, ?);",
+		"SELECT 'unterminated":                                  "SELECT ?",
+		"SELECT ? FROM users;":                                  "SELECT ? FROM users;",
+	}
+	for query, want := range tests {
+		assert.Equal(t, want, redactSQL(query), query)
+	}
+}
+
+func TestSlowQueryLogArgs(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		time.Sleep(5 * time.Millisecond)
+		return fakeResult{}, nil
+	})
+	logger := &testLogger{}
+	db := &DB{db: srv.open(t)}
+	WithLogger(logger)(db)
+	WithSlowQueryLog(time.Millisecond)(db)
+
+	_, err := db.Exec("UPDATE users SET email = ? WHERE id = ?;", "g@example.com", 42)
+	require.NoError(t, err)
+	lines := logger.logged()
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "UPDATE users SET email = ? WHERE id = ?; args: [**** ****]")
+	assert.NotContains(t, lines[0], "g@example.com")
+
+	var redacted []interface{}
+	WithArgRedactor(func(args []interface{}) []interface{} {
+		redacted = args
+		return []interface{}{"<email>", args[1]}
+	})(db)
+	_, err = db.Exec("UPDATE users SET email = ? WHERE id = ?;", "g@example.com", 42)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"g@example.com", 42}, redacted)
+	lines = logger.logged()
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "args: [<email> 42]")
+	assert.NotContains(t, lines[1], "g@example.com")
+}
@@ -0,0 +1,1353 @@
+package mysqldb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrNoMigrations is returned when WithRequireMigrations is used and no
+// migration files are found.
+var ErrNoMigrations = errors.New("no migration files found")
+
+// ErrMigrationsDirNotFound is returned when the migrations directory
+// doesn't exist in the migrations filesystem.
+var ErrMigrationsDirNotFound = errors.New("migrations directory not found")
+
+// ErrConflictingMigrations is returned by NewDB when more than one source
+// of migrations is configured.
+var ErrConflictingMigrations = errors.New("conflicting migration sources")
+
+// WithMigrationsPath returns an option that will configure the DB to
+// perform automatic migrations from the directory at dir on the local
+// filesystem. It behaves like WithMigrations with os.DirFS(dir). If dir
+// is empty, no migrations will be run.
+func WithMigrationsPath(dir string) Option {
+	return func(db *DB) {
+		if dir == "" {
+			db.setMigrationSource(nil, "")
+			return
+		}
+		db.setMigrationSource(os.DirFS(dir), ".")
+	}
+}
+
+// migrationSource is a directory of migrations in a filesystem.
+type migrationSource struct {
+	fsys fs.FS
+	dir  string
+}
+
+// equal reports whether s and o are the same directory of the same
+// filesystem. Filesystems that aren't comparable, such as fstest.MapFS,
+// are the same if they refer to the same underlying value.
+func (s migrationSource) equal(o migrationSource) bool {
+	if s.dir != o.dir {
+		return false
+	}
+	if s.fsys == nil || o.fsys == nil {
+		return s.fsys == nil && o.fsys == nil
+	}
+
+	a, b := reflect.ValueOf(s.fsys), reflect.ValueOf(o.fsys)
+	if a.Type() != b.Type() {
+		return false
+	}
+	if a.Type().Comparable() {
+		return s.fsys == o.fsys
+	}
+	switch a.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Func:
+		return a.Pointer() == b.Pointer()
+	}
+	return false
+}
+
+// setMigrationSource configures the DB to run the migrations in dir of
+// fsys, recording the source so conflicts can be reported by NewDB.
+func (db *DB) setMigrationSource(fsys fs.FS, dir string) {
+	db.migrationsFS, db.migrationsDir = fsys, dir
+	db.migrationSources = append(db.migrationSources, migrationSource{fsys: fsys, dir: dir})
+}
+
+// checkMigrationSources returns ErrConflictingMigrations if different
+// sources of migrations have been configured.
+func (db *DB) checkMigrationSources() error {
+	for i := 1; i < len(db.migrationSources); i++ {
+		first, source := db.migrationSources[0], db.migrationSources[i]
+		if !source.equal(first) {
+			return fmt.Errorf("%w: directory %q and directory %q", ErrConflictingMigrations, first.dir, source.dir)
+		}
+	}
+	return nil
+}
+
+// WithRequireMigrations returns an option that will configure the DB to
+// fail if the migrations directory doesn't contain any migration files,
+// rather than silently running none. This catches a misconfigured
+// directory, such as the wrong path to an embedded filesystem.
+func WithRequireMigrations() Option {
+	return func(db *DB) {
+		db.requireMigrations = true
+	}
+}
+
+// WithoutAutoMigrate returns an option that will configure the DB not to
+// run its migrations when it's opened. The migrations are still
+// configured, so they can be inspected with PendingMigrations or
+// MigrationPlan and gated on with IsUpToDate, before they're run with
+// Migrate.
+func WithoutAutoMigrate() Option {
+	return func(db *DB) {
+		db.deferMigrations = true
+	}
+}
+
+// Migrate runs the pending migrations, as they're run when the DB is
+// opened without WithoutAutoMigrate.
+func (db *DB) Migrate(ctx context.Context) error {
+	if !db.hasMigrations() {
+		return errors.New("no migrations directory configured")
+	}
+	if err := db.runMigrations(ctx); err != nil {
+		return fmt.Errorf("running migrations: %w", err)
+	}
+	return nil
+}
+
+// ErrEmptyMigration is returned when a migration file has no statements,
+// unless WithAllowEmptyMigrations is used.
+var ErrEmptyMigration = errors.New("migration has no statements")
+
+// WithAllowEmptyMigrations returns an option that will configure the DB
+// to treat migration files that are empty, or only contain whitespace, as
+// migrations that do nothing, and record them as applied. This allows for
+// placeholder files, such as one left behind when a migration is moved.
+// By default, an empty migration is an error, since it's more likely to
+// be a mistake, such as an unsaved file.
+func WithAllowEmptyMigrations() Option {
+	return func(db *DB) {
+		db.allowEmptyMigrations = true
+	}
+}
+
+// ErrMigrationTooLarge is returned when a migration file is larger than
+// the size set by WithMaxMigrationSize.
+var ErrMigrationTooLarge = errors.New("migration is too large")
+
+// WithMaxMigrationSize returns an option that will configure the DB to
+// refuse migration files larger than bytes, checking each file's size
+// before it's read. This guards against a runaway generated migration
+// exhausting memory, such as when it's rendered as a template.
+func WithMaxMigrationSize(bytes int64) Option {
+	return func(db *DB) {
+		db.maxMigrationSize = bytes
+	}
+}
+
+// migrationTooLarge reports whether the named migration is larger than
+// the maximum migration size, if one is set.
+func (db *DB) migrationTooLarge(migration string) (bool, error) {
+	if db.maxMigrationSize <= 0 {
+		return false, nil
+	}
+
+	p := path.Join(db.migrationsDir, migration)
+	info, err := fs.Stat(db.migrationsFS, p)
+	if err != nil {
+		return false, fmt.Errorf("reading file info %s: %w", p, err)
+	}
+	return info.Size() > db.maxMigrationSize, nil
+}
+
+// checkMigrationSizes checks that none of the named migrations are larger
+// than the maximum migration size, naming every one that is.
+func (db *DB) checkMigrationSizes(migrations []string) error {
+	var oversized []string
+	for _, migration := range migrations {
+		tooLarge, err := db.migrationTooLarge(migration)
+		if err != nil {
+			return err
+		}
+		if tooLarge {
+			oversized = append(oversized, migration)
+		}
+	}
+
+	if len(oversized) > 0 {
+		return fmt.Errorf("%w, over %d bytes: %s", ErrMigrationTooLarge, db.maxMigrationSize, strings.Join(oversized, ", "))
+	}
+	return nil
+}
+
+// WithMigrationTemplateData returns an option that will configure the DB
+// to render migrations as text/template templates with data before running
+// them, so they can reference values such as {{ .SchemaName }}. Files with
+// a `.sql.tmpl` extension are also run as migrations. Plain `.sql` files
+// are only rendered if they contain template actions.
+func WithMigrationTemplateData(data map[string]interface{}) Option {
+	return func(db *DB) {
+		db.migrationTemplateData = data
+	}
+}
+
+// WithStatementLevelMigrations returns an option that will configure the
+// DB to track migrations by statement rather than by file. The SHA-256
+// hash of every statement executed is recorded in a __MigrationStatements
+// table, and only statements that haven't been recorded for a file are
+// executed, even if the file itself has already been applied. This allows
+// statements to be appended to a migration during development.
+//
+// This isn't recommended for production use: editing a statement causes
+// it to be executed again, identical statements within a file are only
+// executed once, and removing a statement doesn't undo it.
+func WithStatementLevelMigrations() Option {
+	return func(db *DB) {
+		db.statementLevelMigrations = true
+	}
+}
+
+// WithTransactionalDML returns an option that will configure the DB to
+// run each contiguous run of DML statements (INSERT, UPDATE, DELETE and
+// REPLACE) within a migration file in its own transaction. Every other
+// statement is run outside a transaction, and ends any run before it,
+// since MySQL implicitly commits DDL such as CREATE or ALTER TABLE.
+//
+// The guarantee is only partial: if a statement fails, the statements
+// before it in the same run of DML are rolled back, but earlier runs and
+// every other statement before it stay applied. The migration isn't
+// recorded, so it's run again in full next time, and should be written
+// to tolerate that e.g. with CREATE TABLE IF NOT EXISTS. Tables using a
+// non-transactional engine, such as MyISAM, aren't rolled back at all.
+func WithTransactionalDML() Option {
+	return func(db *DB) {
+		db.transactionalDML = true
+	}
+}
+
+// ErrMigrationOutOfOrder is returned when WithAppendOnlyMigrations is
+// used and a migration has been added before an applied migration.
+var ErrMigrationOutOfOrder = errors.New("migration is out of order")
+
+// WithAppendOnlyMigrations returns an option that will configure the DB
+// to refuse to migrate unless the applied migrations, in the order they
+// were applied, are the first of the migration files in sorted order.
+// This catches a migration added with a name that sorts before one that
+// has already been applied, which would otherwise be run out of order,
+// as well as an applied migration that has been renamed.
+func WithAppendOnlyMigrations() Option {
+	return func(db *DB) {
+		db.appendOnlyMigrations = true
+	}
+}
+
+// WithBeforeMigrate returns an option that will configure the DB to call
+// fn before any migrations are run. An error from fn aborts the migrations.
+func WithBeforeMigrate(fn func(Conn) error) Option {
+	return func(db *DB) {
+		db.beforeMigrate = fn
+	}
+}
+
+// WithAfterMigrate returns an option that will configure the DB to call
+// fn after all migrations have been run successfully.
+func WithAfterMigrate(fn func(Conn) error) Option {
+	return func(db *DB) {
+		db.afterMigrate = fn
+	}
+}
+
+// WithMigrationSort returns an option that will configure the DB to run
+// migrations in the order given by less, which reports whether the
+// migration named a must run before b, instead of sorting their filenames
+// lexically. This suits names that don't sort lexically, such as
+// timestamps of varying widths.
+func WithMigrationSort(less func(a, b string) bool) Option {
+	return func(db *DB) {
+		db.migrationLess = less
+	}
+}
+
+// WithMigrationSQLTransform returns an option that will configure the DB
+// to pass the SQL of every migration through fn before it's run, such as
+// to add a tenant's schema prefix. fn is called with the migration's name
+// and its SQL, after any template has been rendered, and returns the SQL
+// to run. An error from fn aborts the migrations.
+func WithMigrationSQLTransform(fn func(filename, sql string) (string, error)) Option {
+	return func(db *DB) {
+		db.migrationTransform = fn
+	}
+}
+
+// WithMigrationProgress returns an option that will configure the DB to
+// call fn before each pending migration is run, with the migration's
+// 1-based position among the pending migrations, the number pending,
+// and its filename. This can drive a progress bar for long migrations.
+func WithMigrationProgress(fn func(done, total int, name string)) Option {
+	return func(db *DB) {
+		db.migrationProgress = fn
+	}
+}
+
+// ModifiedMigrationPolicy controls what happens when a migration that has
+// already been applied has been modified since.
+type ModifiedMigrationPolicy int
+
+const (
+	// ModifiedMigrationIgnore skips modified migrations silently. It's the
+	// default, and it doesn't record checksums.
+	ModifiedMigrationIgnore ModifiedMigrationPolicy = iota
+	// ModifiedMigrationError fails the migrations with
+	// ErrMigrationModified.
+	ModifiedMigrationError
+	// ModifiedMigrationWarn logs modified migrations and skips them.
+	ModifiedMigrationWarn
+)
+
+// ErrMigrationModified is returned when ModifiedMigrationError is used and
+// an applied migration has been modified.
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+// WithOnModifiedMigration returns an option that will configure the DB to
+// handle applied migrations that have been modified according to policy.
+// Unless the policy is ModifiedMigrationIgnore, the SHA-256 checksum of
+// each migration's SQL, as run, is recorded in the migrations table, and
+// compared to the migration file when the migrations are next run.
+// Migrations applied before checksums were recorded have the checksum
+// of their current SQL recorded instead. Migrations tracked by statement
+// aren't checked, as WithStatementLevelMigrations expects them to change.
+func WithOnModifiedMigration(policy ModifiedMigrationPolicy) Option {
+	return func(db *DB) {
+		db.modifiedMigrationPolicy = policy
+	}
+}
+
+// trackChecksums reports whether migration checksums are recorded.
+func (db *DB) trackChecksums() bool {
+	return db.modifiedMigrationPolicy != ModifiedMigrationIgnore
+}
+
+// migrationsConn returns the Conn that migrations and their bookkeeping
+// statements are run through, which is the DB itself unless a test has
+// substituted a fake.
+func (db *DB) migrationsConn() Conn {
+	if db.migrationConn != nil {
+		return db.migrationConn
+	}
+	return db
+}
+
+// hasMigrations reports whether migrations, or a bootstrap schema, have
+// been configured.
+func (db *DB) hasMigrations() bool {
+	return db.migrationsDir != "" || db.bootstrap != nil
+}
+
+// runMigrations runs the pending migrations, or applies the bootstrap
+// schema if one is configured and the database is empty.
+func (db *DB) runMigrations(ctx context.Context) error {
+	return db.runMigrationsWith(ctx, db.bootstrap)
+}
+
+// runMigrationsWith runs the pending migrations, or applies bootstrap, if
+// it isn't nil, when the database is empty.
+func (db *DB) runMigrationsWith(ctx context.Context, bootstrap *bootstrapSchema) (err error) {
+	if db.tableLockTTL > 0 {
+		var owner string
+		if owner, err = db.acquireTableLock(ctx); err != nil {
+			return err
+		}
+		defer func() {
+			if rerr := db.releaseTableLock(owner); err == nil {
+				err = rerr
+			}
+		}()
+	}
+
+	if err := db.createMigrationsTables(); err != nil {
+		return err
+	}
+
+	var migrations []string
+	if db.migrationsDir != "" {
+		if migrations, err = db.migrationFiles(); err != nil {
+			return err
+		}
+	}
+
+	if len(migrations) == 0 && db.requireMigrations {
+		return fmt.Errorf("%w in %s", ErrNoMigrations, db.migrationsDir)
+	}
+
+	if err = db.checkMigrationSizes(migrations); err != nil {
+		return err
+	}
+
+	if db.beforeMigrate != nil {
+		if err = db.beforeMigrate(db.migrationsConn()); err != nil {
+			return fmt.Errorf("running before migrate hook: %w", err)
+		}
+	}
+
+	bootstrapped := false
+	if bootstrap != nil {
+		if bootstrapped, err = db.bootstrapIfEmpty(bootstrap, migrations); err != nil {
+			return err
+		}
+	}
+
+	if !bootstrapped {
+		if err = db.applyPendingMigrations(ctx, migrations); err != nil {
+			return err
+		}
+	}
+
+	if db.afterMigrate != nil {
+		if err = db.afterMigrate(db.migrationsConn()); err != nil {
+			return fmt.Errorf("running after migrate hook: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// applyPendingMigrations applies the given migrations that haven't been
+// applied yet, in order.
+func (db *DB) applyPendingMigrations(ctx context.Context, migrations []string) error {
+	if db.appendOnlyMigrations {
+		if err := db.checkAppendOnly(migrations); err != nil {
+			return err
+		}
+	}
+
+	pending, applied, err := db.pendingMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	if err = db.validateMigrations(pending); err != nil {
+		return err
+	}
+
+	for i, migration := range pending {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if db.migrationProgress != nil {
+			db.migrationProgress(i+1, len(pending), migration)
+		}
+
+		r, err := db.openMigration(migration)
+		if err != nil {
+			return err
+		}
+		err = db.applyMigration(migration, r, applied[migration])
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations that need to be run, in order,
+// and which of them have already been applied. Applied migrations are
+// only pending when migrations are tracked by statement.
+func (db *DB) pendingMigrations(migrations []string) ([]string, map[string]bool, error) {
+	pending := make([]string, 0, len(migrations))
+	applied := make(map[string]bool)
+	for _, migration := range migrations {
+		ok, err := db.migrationApplied(migration)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ok && !db.statementLevelMigrations {
+			if err = db.checkModifiedMigration(migration); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		pending = append(pending, migration)
+		applied[migration] = ok
+	}
+	return pending, applied, nil
+}
+
+// checkAppendOnly returns ErrMigrationOutOfOrder unless the migrations
+// recorded in the migrations table, in the order they were applied, are
+// a prefix of migrations. Recorded names that aren't migration files,
+// such as the schema recorded by BootstrapOrMigrate, are ignored.
+func (db *DB) checkAppendOnly(migrations []string) error {
+	files := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		files[migration] = true
+	}
+
+	rows, err := db.migrationsConn().Query("SELECT `Name` FROM __Migrations ORDER BY ID;")
+	if err != nil {
+		return fmt.Errorf("querying for applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	// a migration recorded more than once, such as by a hand-edited
+	// table, is taken to be applied at its first position
+	var applied []string
+	isApplied := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return fmt.Errorf("scanning applied migration: %w", err)
+		}
+		if files[name] && !isApplied[name] {
+			applied = append(applied, name)
+			isApplied[name] = true
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("iterating applied migrations: %w", err)
+	}
+
+	for i, name := range applied {
+		if migrations[i] == name {
+			continue
+		}
+		if !isApplied[migrations[i]] {
+			return fmt.Errorf("%w: %s sorts before applied migration %s", ErrMigrationOutOfOrder, migrations[i], name)
+		}
+		return fmt.Errorf("%w: %s was applied before %s", ErrMigrationOutOfOrder, name, migrations[i])
+	}
+	return nil
+}
+
+// checkModifiedMigration compares the checksum recorded for the named
+// applied migration with its current checksum, if checksums are tracked,
+// and handles a mismatch according to the modified migration policy.
+func (db *DB) checkModifiedMigration(migration string) error {
+	if !db.trackChecksums() {
+		return nil
+	}
+
+	current, err := db.migrationChecksum(migration)
+	if err != nil {
+		return err
+	}
+
+	var recorded sql.NullString
+	row := db.migrationsConn().QueryRow("SELECT Checksum FROM __Migrations WHERE `Name` = ? LIMIT 1;", migration)
+	if err = row.Scan(&recorded); err != nil {
+		return fmt.Errorf("querying for migration checksum: %w", err)
+	}
+
+	if !recorded.Valid {
+		_, err = db.migrationsConn().Exec("UPDATE __Migrations SET Checksum = ? WHERE `Name` = ?;", current, migration)
+		if err != nil {
+			return fmt.Errorf("updating migration checksum '%s': %w", migration, err)
+		}
+		return nil
+	}
+
+	if recorded.String == current {
+		return nil
+	}
+
+	switch db.modifiedMigrationPolicy {
+	case ModifiedMigrationError:
+		return fmt.Errorf("%w: %s", ErrMigrationModified, migration)
+	case ModifiedMigrationWarn:
+		db.log().Printf("mysqldb: migration %s has been modified since it was applied", migration)
+	}
+	return nil
+}
+
+// migrationChecksum returns the hex encoded SHA-256 checksum of the named
+// migration's SQL.
+func (db *DB) migrationChecksum(migration string) (string, error) {
+	r, err := db.openMigration(migration)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("reading migration %s: %w", migration, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// openMigration opens the named migration in the migrations directory.
+// Migrations are streamed from the filesystem, unless they need to be
+// read into memory to be rendered or transformed.
+func (db *DB) openMigration(migration string) (io.ReadCloser, error) {
+	if tooLarge, err := db.migrationTooLarge(migration); err != nil {
+		return nil, err
+	} else if tooLarge {
+		return nil, fmt.Errorf("%w, over %d bytes: %s", ErrMigrationTooLarge, db.maxMigrationSize, migration)
+	}
+
+	p := path.Join(db.migrationsDir, migration)
+	if db.migrationTemplateData == nil && db.migrationTransform == nil {
+		f, err := db.migrationsFS.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading file %s: %w", p, err)
+		}
+		return f, nil
+	}
+
+	s, err := fs.ReadFile(db.migrationsFS, p)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", p, err)
+	}
+
+	sql, err := db.renderMigration(migration, string(s))
+	if err != nil {
+		return nil, err
+	}
+	if sql, err = db.transformMigration(migration, sql); err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(sql)), nil
+}
+
+// transformMigration runs the named migration's SQL through the
+// configured transform, if there is one.
+func (db *DB) transformMigration(migration, sql string) (string, error) {
+	if db.migrationTransform == nil {
+		return sql, nil
+	}
+
+	sql, err := db.migrationTransform(migration, sql)
+	if err != nil {
+		return "", fmt.Errorf("transforming migration %s: %w", migration, err)
+	}
+	return sql, nil
+}
+
+// validateMigrations checks that every named migration can be split into
+// statements, and has some unless empty migrations are allowed, so a
+// malformed migration is caught before any migration is run.
+func (db *DB) validateMigrations(migrations []string) error {
+	var invalid, empty []string
+	for _, migration := range migrations {
+		r, err := db.openMigration(migration)
+		if err != nil {
+			return err
+		}
+		statements := 0
+		err = splitStatementsReader(r, func(string) error {
+			statements++
+			return nil
+		})
+		r.Close()
+		if errors.Is(err, errUnexpectedEnd) {
+			invalid = append(invalid, migration)
+		} else if err != nil {
+			return fmt.Errorf("reading migration %s: %w", migration, err)
+		} else if statements == 0 && !db.allowEmptyMigrations {
+			empty = append(empty, migration)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("unexpected end of migration: %s", strings.Join(invalid, ", "))
+	}
+	if len(empty) > 0 {
+		return fmt.Errorf("%w: %s", ErrEmptyMigration, strings.Join(empty, ", "))
+	}
+	return nil
+}
+
+// ErrAmbiguousMigrationOrder is returned by ValidateMigrationFS when two
+// migrations don't have a clear order, such as when they share a version
+// number.
+var ErrAmbiguousMigrationOrder = errors.New("ambiguous migration order")
+
+// ValidateMigrationFS checks the migrations in dir of fsys as NewDB would
+// with WithMigrations and WithRequireMigrations, without a database, so a
+// missing or malformed migration is caught by a test before it's
+// deployed. It returns ErrMigrationsDirNotFound if dir doesn't exist,
+// ErrNoMigrations if it has no .sql files, and an error if any file can't
+// be split into statements or is empty. It also returns
+// ErrAmbiguousMigrationOrder if two files share a leading version number,
+// such as 002_users.sql and 002_posts.sql, or differ only by case.
+func ValidateMigrationFS(fsys fs.FS, dir string) error {
+	db := &DB{migrationsFS: fsys, migrationsDir: dir}
+	migrations, err := db.migrationFiles()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return fmt.Errorf("%w in %s", ErrNoMigrations, dir)
+	}
+
+	names := make(map[string]string, len(migrations))
+	versions := make(map[string]string, len(migrations))
+	for _, migration := range migrations {
+		lower := strings.ToLower(migration)
+		if other, ok := names[lower]; ok {
+			return fmt.Errorf("%w: %s and %s differ only by case", ErrAmbiguousMigrationOrder, other, migration)
+		}
+		names[lower] = migration
+
+		version := migration[:len(migration)-len(strings.TrimLeft(migration, "0123456789"))]
+		if version == "" {
+			continue
+		}
+		if other, ok := versions[version]; ok {
+			return fmt.Errorf("%w: %s and %s share version %s", ErrAmbiguousMigrationOrder, other, migration, version)
+		}
+		versions[version] = migration
+	}
+
+	return db.validateMigrations(migrations)
+}
+
+// WithMigrateConcurrency returns an option that will configure MigrateAll
+// to migrate up to n databases at once. By default they're migrated one
+// at a time. It has no effect on NewDB.
+func WithMigrateConcurrency(n int) Option {
+	return func(db *DB) {
+		db.migrateConcurrency = n
+	}
+}
+
+// MigrateAll runs the migrations in dir of migrationsFS against each of
+// the databases in dsns, such as the shards of a sharded deployment. Each
+// database is opened with NewDB and the given options, migrated, and then
+// closed. Every database is migrated even if some fail, and the failures
+// are returned together, identifying each database by its address and
+// name. Use WithMigrateConcurrency to migrate several at once.
+func MigrateAll(dsns []string, migrationsFS fs.FS, dir string, options ...Option) error {
+	var settings DB
+	for _, o := range options {
+		o(&settings)
+	}
+	limit := settings.migrateConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	options = append(options[:len(options):len(options)], WithMigrations(migrationsFS, dir))
+	errs := make([]error, len(dsns))
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, dsn := range dsns {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dsn string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = migrateDSN(dsn, options)
+		}(i, dsn)
+	}
+	wg.Wait()
+
+	var failed errorList
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// migrateDSN opens the database at dsn with options, which run its
+// migrations, and closes it again.
+func migrateDSN(dsn string, options []Option) error {
+	target := "invalid dsn"
+	if cfg, err := mysql.ParseDSN(dsn); err == nil {
+		target = cfg.Addr + "/" + cfg.DBName
+	}
+
+	db, err := NewDB(dsn, options...)
+	if err != nil {
+		return fmt.Errorf("migrating %s: %w", target, err)
+	}
+	if err = db.Close(); err != nil {
+		return fmt.Errorf("closing %s: %w", target, err)
+	}
+	return nil
+}
+
+// ApplyMigration runs the migration read from r and records it under name,
+// unless a migration with that name has already been applied. This allows
+// migrations to be generated at runtime rather than read from an fs.FS.
+func (db *DB) ApplyMigration(name string, r io.Reader) error {
+	if err := db.createMigrationsTables(); err != nil {
+		return err
+	}
+
+	applied, err := db.migrationApplied(name)
+	if err != nil {
+		return err
+	}
+
+	if applied && !db.statementLevelMigrations {
+		return nil
+	}
+
+	if db.migrationTransform != nil {
+		s, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", name, err)
+		}
+
+		sql, err := db.transformMigration(name, string(s))
+		if err != nil {
+			return err
+		}
+		r = strings.NewReader(sql)
+	}
+
+	return db.applyMigration(name, r, applied)
+}
+
+// PendingMigrations returns the names of the migration files that haven't
+// been applied yet, in the order they would be run. Nothing is created in
+// the database, so it's safe to call before migrating.
+func (db *DB) PendingMigrations() ([]string, error) {
+	if db.migrationsDir == "" {
+		return nil, nil
+	}
+
+	migrations, err := db.migrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := db.TableExists("__Migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return migrations, nil
+	}
+
+	pending := make([]string, 0, len(migrations))
+	for _, migration := range migrations {
+		applied, err := db.migrationApplied(migration)
+		if err != nil {
+			return nil, err
+		}
+		if !applied {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// PlannedStatement is a statement that a pending migration will execute.
+type PlannedStatement struct {
+	// File is the name of the migration file the statement is from.
+	File string
+	// Index is the position of the statement within the file, from 0.
+	Index int
+	SQL   string
+}
+
+// MigrationPlan returns the statements of every pending migration, as
+// reported by PendingMigrations, in the order they will be executed. Each
+// migration is rendered and transformed as it would be when run, but
+// nothing is executed or created in the database, so the plan can be
+// reviewed before migrating with a DB opened with WithoutAutoMigrate.
+func (db *DB) MigrationPlan() ([]PlannedStatement, error) {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]PlannedStatement, 0)
+	for _, migration := range pending {
+		r, err := db.openMigration(migration)
+		if err != nil {
+			return nil, err
+		}
+		index := 0
+		err = splitStatementsReader(r, func(stmt string) error {
+			plan = append(plan, PlannedStatement{File: migration, Index: index, SQL: stmt})
+			index++
+			return nil
+		})
+		r.Close()
+		if errors.Is(err, errUnexpectedEnd) {
+			return nil, fmt.Errorf("unexpected end of migration: %s", migration)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", migration, err)
+		}
+	}
+	return plan, nil
+}
+
+// IsUpToDate reports whether every migration file has been applied, which
+// is convenient for readiness checks that should fail until the schema has
+// been migrated. Migrations run when the DB is opened, unless
+// WithoutAutoMigrate is used, so it's otherwise always true.
+func (db *DB) IsUpToDate() (bool, error) {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return false, err
+	}
+	return len(pending) == 0, nil
+}
+
+// bootstrapSchema is a schema file applied to an empty database in place
+// of its migrations.
+type bootstrapSchema struct {
+	fsys fs.FS
+	path string
+}
+
+// WithBootstrapSchema returns an option that will configure the DB to
+// apply the schema file at path in fsys when its database has no tables
+// other than the DB's bookkeeping tables, such as on a fresh deploy, and
+// otherwise to run the migrations as usual. The schema is taken to be the
+// baseline that the existing migration files lead to, so after a
+// bootstrap the schema file and every migration file are recorded in the
+// migrations table, and only migrations added later will be run. The
+// bootstrap is run in place of the migrations, with the same hooks and
+// migrations table lock.
+func WithBootstrapSchema(fsys fs.FS, path string) Option {
+	return func(db *DB) {
+		db.bootstrap = &bootstrapSchema{fsys: fsys, path: path}
+	}
+}
+
+// BootstrapOrMigrate applies the schema file at schemaPath in schemaFS
+// if the database has no tables other than the DB's bookkeeping tables,
+// and otherwise runs the migrations, as described for WithBootstrapSchema.
+// It's meant for a DB opened with WithoutAutoMigrate.
+func (db *DB) BootstrapOrMigrate(schemaFS fs.FS, schemaPath string) error {
+	return db.runMigrationsWith(context.Background(), &bootstrapSchema{fsys: schemaFS, path: schemaPath})
+}
+
+// bootstrapIfEmpty applies the bootstrap schema and records it, and the
+// given migrations, as applied if the database has no user tables. It
+// reports whether it did.
+func (db *DB) bootstrapIfEmpty(bootstrap *bootstrapSchema, migrations []string) (bool, error) {
+	tables, err := db.userTables()
+	if err != nil {
+		return false, err
+	}
+	if len(tables) > 0 {
+		return false, nil
+	}
+
+	ddl, err := fs.ReadFile(bootstrap.fsys, bootstrap.path)
+	if err != nil {
+		return false, fmt.Errorf("reading schema file %s: %w", bootstrap.path, err)
+	}
+	if err = execScript(db.migrationsConn(), string(ddl)); err != nil {
+		return false, fmt.Errorf("loading schema: %w", err)
+	}
+
+	schemaName := path.Base(bootstrap.path)
+	applied, err := db.migrationApplied(schemaName)
+	if err != nil {
+		return false, err
+	}
+	if !applied {
+		var checksum string
+		if db.trackChecksums() {
+			sum := sha256.Sum256(ddl)
+			checksum = hex.EncodeToString(sum[:])
+		}
+		if err = db.recordMigration(schemaName, checksum); err != nil {
+			return false, err
+		}
+	}
+
+	for _, migration := range migrations {
+		applied, err := db.migrationApplied(migration)
+		if err != nil {
+			return false, err
+		}
+		if applied {
+			continue
+		}
+
+		var checksum string
+		if db.trackChecksums() {
+			if checksum, err = db.migrationChecksum(migration); err != nil {
+				return false, err
+			}
+		}
+		if err = db.recordMigration(migration, checksum); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// RepairMigrations reconciles the migrations table with the database after
+// it's been changed by hand. The migrations named in markApplied are
+// recorded as applied and those in markPending are forgotten, so they'll
+// run again, without executing any of their SQL. Every name must be a
+// migration file in the migrations directory, and it's an error to name a
+// migration in both lists. A DB whose migrations table has drifted will
+// usually fail to migrate, so open it with WithoutAutoMigrate to repair
+// it, and then call Migrate.
+func (db *DB) RepairMigrations(markApplied []string, markPending []string) error {
+	if db.migrationsDir == "" {
+		return errors.New("no migrations directory configured")
+	}
+
+	migrations, err := db.migrationFiles()
+	if err != nil {
+		return err
+	}
+	files := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		files[migration] = true
+	}
+
+	applied := make(map[string]bool, len(markApplied))
+	for _, name := range markApplied {
+		if !files[name] {
+			return fmt.Errorf("unknown migration %s", name)
+		}
+		applied[name] = true
+	}
+	for _, name := range markPending {
+		if !files[name] {
+			return fmt.Errorf("unknown migration %s", name)
+		}
+		if applied[name] {
+			return fmt.Errorf("migration %s can't be marked both applied and pending", name)
+		}
+	}
+
+	if err = db.createMigrationsTables(); err != nil {
+		return err
+	}
+
+	for _, name := range markApplied {
+		ok, err := db.migrationApplied(name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+
+		var checksum string
+		if db.trackChecksums() {
+			if checksum, err = db.migrationChecksum(name); err != nil {
+				return err
+			}
+		}
+		if err = db.recordMigration(name, checksum); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range markPending {
+		if _, err = db.migrationsConn().Exec("DELETE FROM __Migrations WHERE `Name` = ?;", name); err != nil {
+			return fmt.Errorf("deleting migration record '%s': %w", name, err)
+		}
+		if !db.statementLevelMigrations {
+			continue
+		}
+		if _, err = db.migrationsConn().Exec("DELETE FROM __MigrationStatements WHERE Migration = ?;", name); err != nil {
+			return fmt.Errorf("deleting migration statement records '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// createMigrationsTables creates the tables used to track migrations if
+// they don't exist already.
+func (db *DB) createMigrationsTables() error {
+	_, err := db.migrationsConn().Exec(`
+CREATE TABLE IF NOT EXISTS __Migrations (
+	ID INT NOT NULL AUTO_INCREMENT,
+	` + "`" + `Name` + "`" + ` VARCHAR(255) NOT NULL,
+	RunAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	Checksum CHAR(64) NULL,
+	PRIMARY KEY(ID)
+);`)
+	if err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	if db.trackChecksums() {
+		if err = db.addChecksumColumn(); err != nil {
+			return err
+		}
+	}
+
+	if db.statementLevelMigrations {
+		_, err = db.migrationsConn().Exec(`
+CREATE TABLE IF NOT EXISTS __MigrationStatements (
+	ID INT NOT NULL AUTO_INCREMENT,
+	Migration VARCHAR(255) NOT NULL,
+	Hash CHAR(64) NOT NULL,
+	RunAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(ID),
+	UNIQUE KEY(Migration, Hash)
+);`)
+		if err != nil {
+			return fmt.Errorf("creating migration statements table: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// addChecksumColumn adds the Checksum column to a migrations table created
+// before checksums were recorded.
+func (db *DB) addChecksumColumn() error {
+	var exists Bool
+	row := db.migrationsConn().QueryRow(`
+SELECT EXISTS(
+	SELECT 1 FROM information_schema.COLUMNS
+	WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = '__Migrations' AND COLUMN_NAME = 'Checksum'
+);`)
+	if err := row.Scan(&exists); err != nil {
+		return fmt.Errorf("querying for checksum column: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := db.migrationsConn().Exec("ALTER TABLE __Migrations ADD COLUMN Checksum CHAR(64) NULL;"); err != nil {
+		return fmt.Errorf("adding checksum column: %w", err)
+	}
+	return nil
+}
+
+// migrationFiles returns the names of the migration files in the
+// migrations directory, in the order they should be run.
+func (db *DB) migrationFiles() ([]string, error) {
+	entries, err := fs.ReadDir(db.migrationsFS, db.migrationsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrMigrationsDirNotFound, db.migrationsDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+
+	migrations := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !db.isMigrationFile(entry.Name()) {
+			continue
+		}
+
+		migrations = append(migrations, entry.Name())
+	}
+
+	if db.migrationLess != nil {
+		sort.SliceStable(migrations, func(i, j int) bool {
+			return db.migrationLess(migrations[i], migrations[j])
+		})
+	} else {
+		sort.Strings(migrations)
+	}
+	return migrations, nil
+}
+
+// isMigrationFile reports whether the named file is a migration. Files
+// with a `.sql.tmpl` extension are only migrations when template data
+// has been provided.
+func (db *DB) isMigrationFile(name string) bool {
+	name = strings.ToLower(name)
+	if db.migrationTemplateData != nil && strings.HasSuffix(name, ".sql.tmpl") {
+		return true
+	}
+	return path.Ext(name) == ".sql"
+}
+
+// renderMigration executes the named migration as a template with the
+// configured template data. Plain `.sql` files without any template
+// actions are returned untouched.
+func (db *DB) renderMigration(migration, sql string) (string, error) {
+	if db.migrationTemplateData == nil {
+		return sql, nil
+	}
+	if !strings.HasSuffix(strings.ToLower(migration), ".tmpl") && !strings.Contains(sql, "{{") {
+		return sql, nil
+	}
+
+	t, err := template.New(migration).Option("missingkey=error").Parse(sql)
+	if err != nil {
+		return "", fmt.Errorf("parsing migration template %s: %w", migration, err)
+	}
+
+	var b strings.Builder
+	if err = t.Execute(&b, db.migrationTemplateData); err != nil {
+		return "", fmt.Errorf("executing migration template %s: %w", migration, err)
+	}
+	return b.String(), nil
+}
+
+// migrationApplied reports whether the named migration has been recorded
+// in the migrations table.
+func (db *DB) migrationApplied(migration string) (bool, error) {
+	var exists Bool
+	row := db.migrationsConn().QueryRow("SELECT COALESCE((SELECT b'1' FROM __Migrations WHERE `Name` = ?), b'0');", migration)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("querying for migration: %w", err)
+	}
+	return bool(exists), nil
+}
+
+// applyMigration executes the statements of the named migration as they're
+// read from r, and records it in the migrations table unless it's already
+// been applied.
+func (db *DB) applyMigration(migration string, r io.Reader, applied bool) error {
+	h := sha256.New()
+	if db.trackChecksums() {
+		r = io.TeeReader(r, h)
+	}
+
+	// tx is the transaction of the current run of DML statements, if any.
+	var tx *Tx
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		err := tx.Commit()
+		tx = nil
+		if err != nil {
+			return fmt.Errorf("committing migration statements: %w", err)
+		}
+		return nil
+	}
+
+	statements := 0
+	err := splitStatementsReader(r, func(stmt string) error {
+		statements++
+		c := db.migrationsConn()
+		if db.transactionalDML {
+			if isDML(stmt) {
+				if tx == nil {
+					beginner, ok := c.(TxBeginner)
+					if !ok {
+						return fmt.Errorf("beginning migration transaction: %T can't begin transactions", c)
+					}
+					var err error
+					if tx, err = beginner.BeginTx(context.Background()); err != nil {
+						return fmt.Errorf("beginning migration transaction: %w", err)
+					}
+				}
+				c = tx
+			} else if err := commit(); err != nil {
+				return err
+			}
+		}
+
+		if db.statementLevelMigrations {
+			return db.applyMigrationStatement(c, migration, stmt)
+		}
+
+		if _, err := c.Exec(stmt); err != nil {
+			return fmt.Errorf("executing migration statement: %w", err)
+		}
+		return nil
+	})
+	if err == nil {
+		err = commit()
+	} else if tx != nil {
+		tx.Rollback()
+	}
+	if errors.Is(err, errUnexpectedEnd) {
+		return fmt.Errorf("unexpected end of migration: %s", migration)
+	}
+	if err != nil {
+		return err
+	}
+	if statements == 0 && !db.allowEmptyMigrations {
+		return fmt.Errorf("%w: %s", ErrEmptyMigration, migration)
+	}
+
+	if applied {
+		return nil
+	}
+
+	var checksum string
+	if db.trackChecksums() {
+		checksum = hex.EncodeToString(h.Sum(nil))
+	}
+	return db.recordMigration(migration, checksum)
+}
+
+// recordMigration records the named migration in the migrations table,
+// along with its checksum unless it's empty.
+func (db *DB) recordMigration(migration, checksum string) error {
+	var err error
+	if checksum == "" {
+		_, err = db.migrationsConn().Exec("INSERT INTO __Migrations(`Name`) VALUES (?);", migration)
+	} else {
+		_, err = db.migrationsConn().Exec("INSERT INTO __Migrations(`Name`, Checksum) VALUES (?, ?);", migration, checksum)
+	}
+	if err != nil {
+		return fmt.Errorf("inserting migration record '%s': %w", migration, err)
+	}
+
+	return nil
+}
+
+// dmlVerbs are the leading verbs of the statements WithTransactionalDML
+// runs in a transaction.
+var dmlVerbs = map[string]bool{
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+// isDML reports whether stmt is a DML statement, judged by its first
+// word after any leading whitespace and comments.
+func isDML(stmt string) bool {
+	word, _ := firstWord(stmt)
+	return dmlVerbs[strings.ToUpper(word)]
+}
+
+// applyMigrationStatement executes a statement of the named migration
+// on c if its hash hasn't been recorded yet, and then records it.
+func (db *DB) applyMigrationStatement(c Conn, migration, stmt string) error {
+	sum := sha256.Sum256([]byte(stmt))
+	hash := hex.EncodeToString(sum[:])
+
+	var exists Bool
+	row := c.QueryRow("SELECT COALESCE((SELECT b'1' FROM __MigrationStatements WHERE Migration = ? AND Hash = ?), b'0');", migration, hash)
+	if err := row.Scan(&exists); err != nil {
+		return fmt.Errorf("querying for migration statement: %w", err)
+	}
+
+	if exists {
+		return nil
+	}
+
+	if _, err := c.Exec(stmt); err != nil {
+		return fmt.Errorf("executing migration statement: %w", err)
+	}
+
+	_, err := c.Exec("INSERT INTO __MigrationStatements(Migration, Hash) VALUES (?, ?);", migration, hash)
+	if err != nil {
+		return fmt.Errorf("inserting migration statement record '%s': %w", migration, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,1255 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMigrationState simulates the migration bookkeeping tables for a
+// fakeServer and records every other statement executed.
+type fakeMigrationState struct {
+	mu             sync.Mutex
+	applied        []string
+	checksums      map[string]interface{}
+	checksumColumn bool
+	statements     map[string]bool
+	executed       []string
+}
+
+func newFakeMigrationState() *fakeMigrationState {
+	return &fakeMigrationState{
+		checksums:      map[string]interface{}{},
+		checksumColumn: true,
+		statements:     map[string]bool{},
+	}
+}
+
+func bitResult(b bool) fakeResult {
+	v := []byte("\x00")
+	if b {
+		v = []byte("\x01")
+	}
+	return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{v}}}
+}
+
+func (s *fakeMigrationState) handle(q fakeQuery) (fakeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.Contains(q.query, "CREATE TABLE IF NOT EXISTS __"):
+		return fakeResult{}, nil
+	case strings.HasPrefix(q.query, "DELETE FROM __Migrations WHERE"):
+		applied := s.applied[:0]
+		for _, name := range s.applied {
+			if name != q.args[0] {
+				applied = append(applied, name)
+			}
+		}
+		s.applied = applied
+		return fakeResult{}, nil
+	case strings.HasPrefix(q.query, "DELETE FROM __MigrationStatements WHERE"):
+		for key := range s.statements {
+			if strings.HasPrefix(key, q.args[0].(string)+"/") {
+				delete(s.statements, key)
+			}
+		}
+		return fakeResult{}, nil
+	case strings.Contains(q.query, "information_schema.COLUMNS"):
+		return bitResult(s.checksumColumn), nil
+	case strings.HasPrefix(q.query, "ALTER TABLE __Migrations ADD COLUMN Checksum"):
+		s.checksumColumn = true
+		return fakeResult{}, nil
+	case strings.HasPrefix(q.query, "SELECT Checksum FROM __Migrations"):
+		return fakeResult{columns: []string{"Checksum"}, rows: [][]driver.Value{{s.checksums[q.args[0].(string)]}}}, nil
+	case strings.HasPrefix(q.query, "UPDATE __Migrations SET Checksum"):
+		s.checksums[q.args[1].(string)] = q.args[0]
+		return fakeResult{affected: 1}, nil
+	case q.query == "SELECT `Name` FROM __Migrations ORDER BY ID;":
+		res := fakeResult{columns: []string{"Name"}}
+		for _, name := range s.applied {
+			res.rows = append(res.rows, []driver.Value{name})
+		}
+		return res, nil
+	case strings.Contains(q.query, "FROM __Migrations WHERE `Name` = ?"):
+		for _, name := range s.applied {
+			if name == q.args[0] {
+				return bitResult(true), nil
+			}
+		}
+		return bitResult(false), nil
+	case strings.HasPrefix(q.query, "INSERT INTO __Migrations("):
+		s.applied = append(s.applied, q.args[0].(string))
+		if len(q.args) > 1 {
+			s.checksums[q.args[0].(string)] = q.args[1]
+		}
+		return fakeResult{affected: 1}, nil
+	case strings.Contains(q.query, "FROM __MigrationStatements WHERE"):
+		return bitResult(s.statements[q.args[0].(string)+"/"+q.args[1].(string)]), nil
+	case strings.HasPrefix(q.query, "INSERT INTO __MigrationStatements("):
+		s.statements[q.args[0].(string)+"/"+q.args[1].(string)] = true
+		return fakeResult{affected: 1}, nil
+	}
+
+	s.executed = append(s.executed, q.query)
+	return fakeResult{}, nil
+}
+
+// executedStatements returns the non-bookkeeping statements executed
+// since the last call.
+func (s *fakeMigrationState) executedStatements() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	executed := s.executed
+	s.executed = nil
+	return executed
+}
+
+func newMigrationsTestDB(t *testing.T, fsys fstest.MapFS, options ...Option) (*DB, *fakeMigrationState) {
+	t.Helper()
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, state.handle)
+
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+	for _, o := range options {
+		o(db)
+	}
+	return db, state
+}
+
+// recordingConn is a Conn that records every statement run through it,
+// without a database. Lookups run with QueryRow scan the value of row.
+type recordingConn struct {
+	statements []string
+	row        func(query string, args []interface{}) interface{}
+}
+
+func (c *recordingConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	c.statements = append(c.statements, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) Query(query string, args ...interface{}) (Rows, error) {
+	return nil, errors.New("unexpected Query: " + query)
+}
+
+func (c *recordingConn) QueryRow(query string, args ...interface{}) Row {
+	c.statements = append(c.statements, query)
+	return recordingRow{c.row(query, args)}
+}
+
+// recordingRow is a Row holding a single value.
+type recordingRow struct {
+	v interface{}
+}
+
+func (r recordingRow) Scan(dest ...interface{}) error {
+	return dest[0].(sql.Scanner).Scan(r.v)
+}
+
+func TestRunMigrationsThroughConn(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/002_trigger.sql": &fstest.MapFile{Data: []byte("delimiter //\nCREATE TRIGGER t BEFORE INSERT ON users FOR EACH ROW BEGIN SET NEW.ID = 1; END//\ndelimiter ;\nINSERT INTO users VALUES (2);")},
+		"migrations/001_users.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	conn := &recordingConn{row: func(query string, args []interface{}) interface{} {
+		return []byte("\x00") // nothing has been applied
+	}}
+	db := &DB{name: "test", migrationConn: conn}
+	WithMigrations(fsys, "migrations")(db)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	require.NotEmpty(t, conn.statements)
+	assert.Contains(t, conn.statements[0], "CREATE TABLE IF NOT EXISTS __Migrations")
+	assert.Equal(t, []string{
+		"SELECT COALESCE((SELECT b'1' FROM __Migrations WHERE `Name` = ?), b'0');",
+		"SELECT COALESCE((SELECT b'1' FROM __Migrations WHERE `Name` = ?), b'0');",
+		"CREATE TABLE users (ID INT);",
+		"INSERT INTO __Migrations(`Name`) VALUES (?);",
+		"CREATE TRIGGER t BEFORE INSERT ON users FOR EACH ROW BEGIN SET NEW.ID = 1; END",
+		"INSERT INTO users VALUES (2);",
+		"INSERT INTO __Migrations(`Name`) VALUES (?);",
+	}, conn.statements[1:])
+}
+
+func TestTransactionalDMLRequiresTxBeginner(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("INSERT INTO users VALUES (1);")},
+	}
+	conn := &recordingConn{row: func(string, []interface{}) interface{} { return []byte("\x00") }}
+	db := &DB{name: "test", migrationConn: conn}
+	WithMigrations(fsys, "migrations")(db)
+	WithTransactionalDML()(db)
+
+	err := db.runMigrations(context.Background())
+	assert.ErrorContains(t, err, "can't begin transactions")
+	assert.NotContains(t, conn.statements, "INSERT INTO users VALUES (1);")
+}
+
+func TestRunMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nINSERT INTO users VALUES (1);")},
+		"migrations/README.md":     &fstest.MapFile{Data: []byte("not a migration")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "INSERT INTO users VALUES (1);", "CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, state.applied)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Empty(t, state.executedStatements())
+}
+
+func TestWithMigrationsPath(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "002_posts.sql"), []byte("CREATE TABLE posts (ID INT);"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "001_users.sql"), []byte("CREATE TABLE users (ID INT);"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "archive"), 0o700))
+
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, state.handle)
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrationsPath(dir)(db)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, state.applied)
+}
+
+func TestStatementLevelMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithStatementLevelMigrations())
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);"}, state.executedStatements())
+
+	fsys["migrations/001_users.sql"].Data = []byte("CREATE TABLE users (ID INT);\nINSERT INTO users VALUES (1);")
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"INSERT INTO users VALUES (1);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+}
+
+func TestWithStatementLevelMigrationsOption(t *testing.T) {
+	db := &DB{}
+	WithStatementLevelMigrations()(db)
+	assert.True(t, db.statementLevelMigrations)
+}
+
+func TestApplyMigration(t *testing.T) {
+	db, state := newMigrationsTestDB(t, fstest.MapFS{})
+
+	r := strings.NewReader("CREATE TABLE users (ID INT);\nINSERT INTO users VALUES (1);")
+	require.NoError(t, db.ApplyMigration("generated_users", r))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "INSERT INTO users VALUES (1);"}, state.executedStatements())
+	assert.Equal(t, []string{"generated_users"}, state.applied)
+
+	require.NoError(t, db.ApplyMigration("generated_users", strings.NewReader("DROP TABLE users;")))
+	assert.Empty(t, state.executedStatements())
+}
+
+func TestMigrateHooks(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+
+	var calls []string
+	var state *fakeMigrationState
+	db, state := newMigrationsTestDB(t, fsys,
+		WithBeforeMigrate(func(c Conn) error {
+			calls = append(calls, "before")
+			assert.Empty(t, state.applied)
+			return nil
+		}),
+		WithAfterMigrate(func(c Conn) error {
+			calls = append(calls, "after")
+			assert.Equal(t, []string{"001_users.sql"}, state.applied)
+			return nil
+		}),
+	)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"before", "after"}, calls)
+}
+
+func TestBeforeMigrateHookError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	hookErr := errors.New("feature flag service unavailable")
+	db, state := newMigrationsTestDB(t, fsys, WithBeforeMigrate(func(Conn) error { return hookErr }))
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), hookErr)
+	assert.Empty(t, state.executedStatements())
+	assert.Empty(t, state.applied)
+}
+
+func TestAfterMigrateHookError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	hookErr := errors.New("notification failed")
+	db, _ := newMigrationsTestDB(t, fsys, WithAfterMigrate(func(Conn) error { return hookErr }))
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), hookErr)
+}
+
+func TestRequireMigrationsEmpty(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/README.md": &fstest.MapFile{Data: []byte("no migrations yet")},
+	}
+	db, _ := newMigrationsTestDB(t, fsys, WithRequireMigrations())
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), ErrNoMigrations)
+}
+
+func TestRequireMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithRequireMigrations())
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+}
+
+func TestAppendOnlyMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithAppendOnlyMigrations())
+	state.applied = []string{"schema.sql"}
+
+	require.NoError(t, db.runMigrations(context.Background()))
+
+	fsys["migrations/002_posts.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")}
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"schema.sql", "001_users.sql", "002_posts.sql"}, state.applied)
+}
+
+func TestAppendOnlyMigrationsInsertion(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/003_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithAppendOnlyMigrations())
+	require.NoError(t, db.runMigrations(context.Background()))
+	state.executedStatements()
+
+	fsys["migrations/002_tags.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")}
+	err := db.runMigrations(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationOutOfOrder)
+	assert.Contains(t, err.Error(), "002_tags.sql sorts before applied migration 003_posts.sql")
+	assert.Empty(t, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "003_posts.sql"}, state.applied)
+
+	delete(fsys, "migrations/002_tags.sql")
+	state.applied = []string{"003_posts.sql", "001_users.sql"}
+	err = db.runMigrations(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationOutOfOrder)
+	assert.Contains(t, err.Error(), "003_posts.sql was applied before 001_users.sql")
+}
+
+func TestAppendOnlyMigrationsDuplicateRecord(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithAppendOnlyMigrations())
+	state.applied = []string{"001_users.sql", "001_users.sql"}
+
+	require.NotPanics(t, func() {
+		assert.NoError(t, db.runMigrations(context.Background()))
+	})
+	assert.Empty(t, state.executedStatements())
+
+	fsys["migrations/002_posts.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")}
+	state.applied = []string{"002_posts.sql", "001_users.sql", "002_posts.sql"}
+	err := db.runMigrations(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationOutOfOrder)
+	assert.Contains(t, err.Error(), "002_posts.sql was applied before 001_users.sql")
+}
+
+func TestEmptyMigration(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":       &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_placeholder.sql": &fstest.MapFile{},
+		"migrations/003_blank.sql":       &fstest.MapFile{Data: []byte(" \n\t\n")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	err := db.runMigrations(context.Background())
+	assert.ErrorIs(t, err, ErrEmptyMigration)
+	assert.Contains(t, err.Error(), "002_placeholder.sql, 003_blank.sql")
+	assert.Empty(t, state.executedStatements(), "nothing runs")
+	assert.Empty(t, state.applied)
+
+	assert.ErrorIs(t, db.ApplyMigration("004_empty.sql", strings.NewReader("")), ErrEmptyMigration)
+	assert.Empty(t, state.applied)
+}
+
+func TestAllowEmptyMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":       &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_placeholder.sql": &fstest.MapFile{},
+		"migrations/003_blank.sql":       &fstest.MapFile{Data: []byte(" \n\t\n")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithAllowEmptyMigrations())
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_placeholder.sql", "003_blank.sql"}, state.applied)
+
+	require.NoError(t, db.ApplyMigration("004_empty.sql", strings.NewReader("")))
+	assert.Contains(t, state.applied, "004_empty.sql")
+}
+
+func TestMaxMigrationSize(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":     &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_generated.sql": &fstest.MapFile{Data: []byte(strings.Repeat("INSERT INTO users VALUES (1);\n", 10))},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithMaxMigrationSize(64))
+
+	err := db.runMigrations(context.Background())
+	assert.ErrorIs(t, err, ErrMigrationTooLarge)
+	assert.Contains(t, err.Error(), "002_generated.sql")
+	assert.NotContains(t, err.Error(), "001_users.sql")
+	assert.Empty(t, state.executedStatements(), "nothing runs")
+	assert.Empty(t, state.applied)
+
+	delete(fsys, "migrations/002_generated.sql")
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+}
+
+func TestValidateMigrationFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_trigger.sql": &fstest.MapFile{Data: []byte("delimiter //\nCREATE TRIGGER t BEFORE INSERT ON users FOR EACH ROW BEGIN SET NEW.ID = 1; END//\n")},
+		"migrations/010_posts.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+		"migrations/README.md":       &fstest.MapFile{Data: []byte("not a migration")},
+	}
+	assert.NoError(t, ValidateMigrationFS(fsys, "migrations"))
+}
+
+func TestValidateMigrationFSInvalid(t *testing.T) {
+	valid := &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")}
+	tests := map[string]struct {
+		fsys fstest.MapFS
+		err  error
+		msg  string
+	}{
+		"missing directory": {
+			fsys: fstest.MapFS{"migration/001_users.sql": valid},
+			err:  ErrMigrationsDirNotFound,
+		},
+		"no migrations": {
+			fsys: fstest.MapFS{"migrations/README.md": &fstest.MapFile{Data: []byte("no migrations yet")}},
+			err:  ErrNoMigrations,
+		},
+		"unterminated statement": {
+			fsys: fstest.MapFS{
+				"migrations/001_users.sql": valid,
+				"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT)")},
+			},
+			msg: "unexpected end of migration: 002_posts.sql",
+		},
+		"empty file": {
+			fsys: fstest.MapFS{"migrations/001_users.sql": &fstest.MapFile{}},
+			err:  ErrEmptyMigration,
+		},
+		"shared version": {
+			fsys: fstest.MapFS{
+				"migrations/002_users.sql": valid,
+				"migrations/002_posts.sql": valid,
+			},
+			err: ErrAmbiguousMigrationOrder,
+			msg: "share version 002",
+		},
+		"names differing by case": {
+			fsys: fstest.MapFS{
+				"migrations/users.sql": valid,
+				"migrations/Users.sql": valid,
+			},
+			err: ErrAmbiguousMigrationOrder,
+		},
+	}
+	for name, test := range tests {
+		err := ValidateMigrationFS(test.fsys, "migrations")
+		require.Error(t, err, name)
+		if test.err != nil {
+			assert.ErrorIs(t, err, test.err, name)
+		}
+		if test.msg != "" {
+			assert.Contains(t, err.Error(), test.msg, name)
+		}
+	}
+}
+
+func TestMigrationsDirNotFound(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migration/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), ErrMigrationsDirNotFound)
+	assert.Empty(t, state.executedStatements())
+}
+
+func TestMigrationsDirEmpty(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations": &fstest.MapFile{Mode: fs.ModeDir},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Empty(t, state.applied)
+}
+
+func TestMigrationTemplateData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":         &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_events.sql.tmpl":   &fstest.MapFile{Data: []byte("CREATE TABLE {{ .SchemaName }}.events (ID INT) PARTITION BY HASH(ID) PARTITIONS {{ .Partitions }};")},
+		"migrations/003_audit.sql":         &fstest.MapFile{Data: []byte("CREATE TABLE {{ .SchemaName }}.audit (ID INT);")},
+		"migrations/004_literal_brace.sql": &fstest.MapFile{Data: []byte("INSERT INTO users VALUES ('}');")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithMigrationTemplateData(map[string]interface{}{
+		"SchemaName": "tenant1",
+		"Partitions": 4,
+	}))
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{
+		"CREATE TABLE users (ID INT);",
+		"CREATE TABLE tenant1.events (ID INT) PARTITION BY HASH(ID) PARTITIONS 4;",
+		"CREATE TABLE tenant1.audit (ID INT);",
+		"INSERT INTO users VALUES ('}');",
+	}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_events.sql.tmpl", "003_audit.sql", "004_literal_brace.sql"}, state.applied)
+}
+
+func TestMigrationTemplatesIgnoredWithoutData(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_events.sql.tmpl": &fstest.MapFile{Data: []byte("CREATE TABLE {{ .SchemaName }}.events (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Empty(t, state.applied)
+}
+
+func TestRunMigrationsCancelled(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		res, err := state.handle(q)
+		if strings.HasPrefix(q.query, "INSERT INTO __Migrations(") {
+			cancel()
+		}
+		return res, err
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+
+	assert.ErrorIs(t, db.runMigrations(ctx), context.Canceled)
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+}
+
+func TestMigrationProgress(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+		"migrations/003_comments.sql": &fstest.MapFile{Data: []byte("CREATE TABLE comments (ID INT);")},
+		"migrations/004_tags.sql":     &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")},
+	}
+
+	type progress struct {
+		done, total int
+		name        string
+	}
+	var calls []progress
+	db, state := newMigrationsTestDB(t, fsys, WithMigrationProgress(func(done, total int, name string) {
+		calls = append(calls, progress{done, total, name})
+	}))
+	state.applied = []string{"001_users.sql"}
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []progress{
+		{1, 3, "002_posts.sql"},
+		{2, 3, "003_comments.sql"},
+		{3, 3, "004_tags.sql"},
+	}, calls)
+}
+
+func TestMalformedMigrationRunsNothing(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT)")},
+		"migrations/003_comments.sql": &fstest.MapFile{Data: []byte("CREATE TABLE comments (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	err := db.runMigrations(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "002_posts.sql")
+	assert.Empty(t, state.executedStatements())
+	assert.Empty(t, state.applied)
+}
+
+func TestMigrationSort(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/2024010199_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+		"migrations/20240102_tags.sql":    &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")},
+		"migrations/20240101_users.sql":   &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+
+	// order by the numeric value of the timestamp prefix
+	timestamp := func(name string) int64 {
+		prefix, _, _ := strings.Cut(name, "_")
+		n, err := strconv.ParseInt(prefix, 10, 64)
+		require.NoError(t, err)
+		return n
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithMigrationSort(func(a, b string) bool {
+		return timestamp(a) < timestamp(b)
+	}))
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"20240101_users.sql", "20240102_tags.sql", "2024010199_posts.sql"}, state.applied)
+}
+
+func TestMigrationSQLTransform(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE __SCHEMA__.users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithMigrationSQLTransform(func(filename, sql string) (string, error) {
+		assert.Equal(t, "001_users.sql", filename)
+		return strings.ReplaceAll(sql, "__SCHEMA__", "tenant_1"), nil
+	}))
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE tenant_1.users (ID INT);"}, state.executedStatements())
+}
+
+func TestMigrationSQLTransformError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	errTransform := errors.New("unknown tenant")
+	db, state := newMigrationsTestDB(t, fsys, WithMigrationSQLTransform(func(filename, sql string) (string, error) {
+		return "", errTransform
+	}))
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), errTransform)
+	assert.Empty(t, state.executedStatements())
+	assert.Empty(t, state.applied)
+}
+
+func TestIsUpToDate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+
+	state := newFakeMigrationState()
+	migrated := false
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			return bitResult(migrated), nil
+		}
+		if strings.Contains(q.query, "CREATE TABLE IF NOT EXISTS __Migrations") {
+			migrated = true
+		}
+		return state.handle(q)
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+
+	pending, err := db.PendingMigrations()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, pending)
+	upToDate, err := db.IsUpToDate()
+	require.NoError(t, err)
+	assert.False(t, upToDate)
+	assert.Empty(t, state.executedStatements(), "nothing is created")
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	fsys["migrations/003_tags.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")}
+
+	pending, err = db.PendingMigrations()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"003_tags.sql"}, pending)
+	upToDate, err = db.IsUpToDate()
+	require.NoError(t, err)
+	assert.False(t, upToDate)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	upToDate, err = db.IsUpToDate()
+	require.NoError(t, err)
+	assert.True(t, upToDate)
+}
+
+func TestWithoutAutoMigrate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+
+	state := newFakeMigrationState()
+	var migrated atomic.Bool
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			return bitResult(migrated.Load()), nil
+		}
+		if strings.Contains(q.query, "CREATE TABLE IF NOT EXISTS __Migrations") {
+			migrated.Store(true)
+		}
+		return state.handle(q)
+	})
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithoutAutoMigrate())
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Empty(t, state.executedStatements(), "nothing runs when opened")
+
+	pending, err := db.PendingMigrations()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, pending)
+	upToDate, err := db.IsUpToDate()
+	require.NoError(t, err)
+	assert.False(t, upToDate)
+
+	require.NoError(t, db.Migrate(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	upToDate, err = db.IsUpToDate()
+	require.NoError(t, err)
+	assert.True(t, upToDate)
+}
+
+func TestMigrateWithoutMigrations(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t), name: "test"}
+	assert.Error(t, db.Migrate(context.Background()))
+}
+
+// bootstrapTestDB returns a DB with the migrations in fsys whose database
+// contains the given user tables.
+func bootstrapTestDB(t *testing.T, fsys fstest.MapFS, tables ...string) (*DB, *fakeMigrationState) {
+	t.Helper()
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			res := fakeResult{columns: []string{"TABLE_NAME"}, rows: [][]driver.Value{{"__Migrations"}}}
+			for _, table := range tables {
+				res.rows = append(res.rows, []driver.Value{table})
+			}
+			return res, nil
+		}
+		return state.handle(q)
+	})
+
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+	return db, state
+}
+
+func TestBootstrapOrMigrateEmptyDatabase(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema.sql":               &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nCREATE TABLE posts (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	db, state := bootstrapTestDB(t, fsys)
+
+	require.NoError(t, db.BootstrapOrMigrate(fsys, "schema.sql"))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"schema.sql", "001_users.sql", "002_posts.sql"}, state.applied)
+
+	fsys["migrations/003_tags.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")}
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE tags (ID INT);"}, state.executedStatements())
+}
+
+func TestBootstrapOrMigrateExistingDatabase(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema.sql":               &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nCREATE TABLE posts (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	db, state := bootstrapTestDB(t, fsys, "users")
+	state.applied = []string{"001_users.sql"}
+
+	require.NoError(t, db.BootstrapOrMigrate(fsys, "schema.sql"))
+	assert.Equal(t, []string{"CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, state.applied)
+}
+
+// bootstrapServer returns a fakeServer for the migrations table lock
+// whose database contains the given user tables, and a users table once
+// a CREATE TABLE users statement has run.
+func bootstrapServer(t *testing.T, lock *fakeTableLock, tables ...string) *fakeServer {
+	t.Helper()
+	lock.state = newFakeMigrationState()
+	var mu sync.Mutex
+	return newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			res := fakeResult{columns: []string{"TABLE_NAME"}, rows: [][]driver.Value{{"__Migrations"}}}
+			for _, table := range tables {
+				res.rows = append(res.rows, []driver.Value{table})
+			}
+			return res, nil
+		}
+		if strings.HasPrefix(q.query, "CREATE TABLE users") {
+			tables = append(tables, "users")
+		}
+		return lock.handle(q)
+	})
+}
+
+func TestWithBootstrapSchema(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema.sql":               &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nCREATE TABLE posts (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	lock := &fakeTableLock{}
+	srv := bootstrapServer(t, lock)
+
+	var hooks []string
+	open := func() (*DB, error) {
+		return NewDB(srv.dsn("app"), withFakeDriver(),
+			WithMigrations(fsys, "migrations"),
+			WithBootstrapSchema(fsys, "schema.sql"),
+			WithTableLock(time.Minute),
+			WithBeforeMigrate(func(Conn) error {
+				hooks = append(hooks, "before")
+				return nil
+			}),
+			WithAfterMigrate(func(Conn) error {
+				hooks = append(hooks, "after")
+				return nil
+			}))
+	}
+
+	db, err := open()
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "CREATE TABLE posts (ID INT);"}, lock.state.executedStatements())
+	assert.Equal(t, []string{"schema.sql", "001_users.sql", "002_posts.sql"}, lock.state.applied)
+	assert.Equal(t, []string{"before", "after"}, hooks)
+	assert.False(t, lock.held, "the table lock is released")
+
+	fsys["migrations/003_tags.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")}
+	again, err := open()
+	require.NoError(t, err)
+	defer again.Close()
+	assert.Equal(t, []string{"CREATE TABLE tags (ID INT);"}, lock.state.executedStatements(), "only new migrations run once bootstrapped")
+}
+
+func TestWithBootstrapSchemaLocked(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema.sql":               &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	lock := &fakeTableLock{held: true, owner: "other", age: (30 * time.Second).Microseconds()}
+	srv := bootstrapServer(t, lock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := NewDBContext(ctx, srv.dsn("app"), withFakeDriver(),
+		WithMigrations(fsys, "migrations"), WithBootstrapSchema(fsys, "schema.sql"), WithTableLock(time.Minute))
+	assert.ErrorIs(t, err, ErrMigrationsLocked)
+	assert.Empty(t, lock.state.executedStatements(), "another instance is bootstrapping")
+	assert.Empty(t, lock.state.applied)
+}
+
+func TestWithBootstrapSchemaExistingDatabase(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schema.sql":               &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nCREATE TABLE posts (ID INT);")},
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	lock := &fakeTableLock{}
+	srv := bootstrapServer(t, lock, "users")
+	lock.state.applied = []string{"001_users.sql"}
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithBootstrapSchema(fsys, "schema.sql"))
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, []string{"CREATE TABLE posts (ID INT);"}, lock.state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, lock.state.applied)
+}
+
+func TestOnModifiedMigration(t *testing.T) {
+	tests := []struct {
+		policy  ModifiedMigrationPolicy
+		wantErr error
+		logged  int
+	}{
+		{ModifiedMigrationIgnore, nil, 0},
+		{ModifiedMigrationError, ErrMigrationModified, 0},
+		{ModifiedMigrationWarn, nil, 1},
+	}
+	for _, test := range tests {
+		fsys := fstest.MapFS{
+			"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		}
+		logger := &testLogger{}
+		db, state := newMigrationsTestDB(t, fsys, WithOnModifiedMigration(test.policy), WithLogger(logger))
+
+		require.NoError(t, db.runMigrations(context.Background()))
+		state.executedStatements()
+
+		fsys["migrations/001_users.sql"].Data = []byte("CREATE TABLE users (ID INT, Name TEXT);")
+		err := db.runMigrations(context.Background())
+		if test.wantErr != nil {
+			assert.ErrorIs(t, err, test.wantErr, "policy %d", test.policy)
+			assert.Contains(t, err.Error(), "001_users.sql")
+		} else {
+			assert.NoError(t, err, "policy %d", test.policy)
+		}
+		assert.Empty(t, state.executedStatements(), "policy %d", test.policy)
+		assert.Len(t, logger.logged(), test.logged, "policy %d", test.policy)
+	}
+}
+
+func TestOnModifiedMigrationUnchanged(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithOnModifiedMigration(ModifiedMigrationError))
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.NotNil(t, state.checksums["001_users.sql"])
+	require.NoError(t, db.runMigrations(context.Background()))
+}
+
+func TestOnModifiedMigrationAddsChecksums(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+	require.NoError(t, db.runMigrations(context.Background()))
+	state.checksumColumn = false
+
+	WithOnModifiedMigration(ModifiedMigrationError)(db)
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.True(t, state.checksumColumn)
+	assert.NotNil(t, state.checksums["001_users.sql"], "the current checksum is recorded")
+
+	fsys["migrations/001_users.sql"].Data = []byte("CREATE TABLE users (ID INT, Name TEXT);")
+	assert.ErrorIs(t, db.runMigrations(context.Background()), ErrMigrationModified)
+}
+
+func TestWithMigrationsRepeated(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	other := fstest.MapFS{
+		"migrations/001_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	srv := newFakeServer(t, newFakeMigrationState().handle)
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithMigrations(fsys, "migrations"))
+	require.NoError(t, err, "identical calls are idempotent")
+	require.NoError(t, db.Close())
+
+	tests := [][]Option{
+		{WithMigrations(fsys, "migrations"), WithMigrations(other, "migrations")},
+		{WithMigrations(fsys, "migrations"), WithMigrations(fsys, "other")},
+		{WithMigrations(fsys, "migrations"), WithMigrationsPath(t.TempDir())},
+		{WithMigrationsPath(t.TempDir()), WithMigrationsPath(t.TempDir())},
+	}
+	for i, options := range tests {
+		connections := srv.connections()
+		_, err = NewDB(srv.dsn("app"), append([]Option{withFakeDriver()}, options...)...)
+		assert.ErrorIs(t, err, ErrConflictingMigrations, "test %d", i)
+		assert.Equal(t, connections, srv.connections(), "test %d: nothing is opened", i)
+	}
+}
+
+func TestRepairMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+		"migrations/003_tags.sql":  &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+	state.applied = []string{"001_users.sql", "002_posts.sql"}
+
+	require.NoError(t, db.RepairMigrations([]string{"003_tags.sql"}, []string{"002_posts.sql"}))
+	assert.Equal(t, []string{"001_users.sql", "003_tags.sql"}, state.applied)
+	assert.Empty(t, state.executedStatements(), "no migration SQL is run")
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE posts (ID INT);"}, state.executedStatements())
+}
+
+func TestRepairMigrationsThroughNewDB(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+
+	// users was created by hand, without being recorded
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if q.query == "CREATE TABLE users (ID INT);" {
+			return fakeResult{}, &mysql.MySQLError{Number: 1050, Message: "Table 'users' already exists"}
+		}
+		return state.handle(q)
+	})
+
+	_, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"))
+	require.Error(t, err, "the drifted migration fails")
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithoutAutoMigrate())
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.RepairMigrations([]string{"001_users.sql"}, nil))
+	require.NoError(t, db.Migrate(context.Background()))
+	assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, state.applied)
+	assert.Equal(t, []string{"CREATE TABLE posts (ID INT);"}, state.executedStatements())
+}
+
+func TestRepairMigrationsStatementLevel(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys, WithStatementLevelMigrations())
+	require.NoError(t, db.runMigrations(context.Background()))
+	state.executedStatements()
+
+	require.NoError(t, db.RepairMigrations(nil, []string{"001_users.sql"}))
+	assert.Empty(t, state.applied)
+	require.NoError(t, db.runMigrations(context.Background()))
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);"}, state.executedStatements())
+}
+
+func TestRepairMigrationsValidatesNames(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	db, state := newMigrationsTestDB(t, fsys)
+
+	assert.ErrorContains(t, db.RepairMigrations([]string{"001_users.sql", "002_missing.sql"}, nil), "unknown migration 002_missing.sql")
+	assert.ErrorContains(t, db.RepairMigrations(nil, []string{"README.md"}), "unknown migration README.md")
+	assert.Error(t, db.RepairMigrations([]string{"001_users.sql"}, []string{"001_users.sql"}))
+	assert.Empty(t, state.applied, "nothing is changed")
+}
+
+func TestMigrateAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);")},
+	}
+	first, second := newFakeMigrationState(), newFakeMigrationState()
+	srv1 := newFakeServer(t, first.handle)
+	srv2 := newFakeServer(t, second.handle)
+
+	dsns := []string{srv1.dsn("shard1"), srv2.dsn("shard2")}
+	require.NoError(t, MigrateAll(dsns, fsys, "migrations", withFakeDriver(), WithMigrateConcurrency(2)))
+	for _, state := range []*fakeMigrationState{first, second} {
+		assert.Equal(t, []string{"001_users.sql", "002_posts.sql"}, state.applied)
+		assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "CREATE TABLE posts (ID INT);"}, state.executedStatements())
+	}
+}
+
+func TestMigrateAllErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	errExists := errors.New("table exists")
+	broken := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if q.query == "CREATE TABLE users (ID INT);" {
+			return fakeResult{}, errExists
+		}
+		return newFakeMigrationState().handle(q)
+	})
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, state.handle)
+
+	err := MigrateAll([]string{"root:secret@tcp(" + broken.addr + ")/shard1", srv.dsn("shard2")}, fsys, "migrations", withFakeDriver())
+	assert.ErrorIs(t, err, errExists)
+	assert.Contains(t, err.Error(), "migrating "+broken.addr+"/shard1: ")
+	assert.NotContains(t, err.Error(), "secret")
+	assert.NotContains(t, err.Error(), "shard2")
+	assert.Equal(t, []string{"001_users.sql"}, state.applied, "later databases are still migrated")
+}
+
+func TestMigrationPlan(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);\nINSERT INTO posts VALUES (1);")},
+		"migrations/003_tags.sql":  &fstest.MapFile{Data: []byte("CREATE TABLE tags (ID INT);\ndelimiter //\nCREATE TRIGGER t BEFORE INSERT ON tags FOR EACH ROW BEGIN SET NEW.ID = 1; END//\ndelimiter ;")},
+	}
+	state := newFakeMigrationState()
+	state.applied = []string{"001_users.sql"}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			return bitResult(true), nil
+		}
+		return state.handle(q)
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+
+	plan, err := db.MigrationPlan()
+	require.NoError(t, err)
+	assert.Equal(t, []PlannedStatement{
+		{File: "002_posts.sql", Index: 0, SQL: "CREATE TABLE posts (ID INT);"},
+		{File: "002_posts.sql", Index: 1, SQL: "INSERT INTO posts VALUES (1);"},
+		{File: "003_tags.sql", Index: 0, SQL: "CREATE TABLE tags (ID INT);"},
+		{File: "003_tags.sql", Index: 1, SQL: "CREATE TRIGGER t BEFORE INSERT ON tags FOR EACH ROW BEGIN SET NEW.ID = 1; END"},
+	}, plan)
+	assert.Empty(t, state.executedStatements(), "nothing is executed")
+	for _, q := range srv.queries() {
+		assert.NotContains(t, q, "CREATE TABLE IF NOT EXISTS")
+	}
+}
+
+func TestMigrationPlanThroughNewDB(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+		"migrations/002_posts.sql": &fstest.MapFile{Data: []byte("CREATE TABLE posts (ID INT);\nINSERT INTO posts VALUES (1);")},
+	}
+	state := newFakeMigrationState()
+	state.applied = []string{"001_users.sql"}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "information_schema.TABLES") {
+			return bitResult(true), nil
+		}
+		return state.handle(q)
+	})
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithoutAutoMigrate())
+	require.NoError(t, err)
+	defer db.Close()
+
+	plan, err := db.MigrationPlan()
+	require.NoError(t, err)
+	assert.Equal(t, []PlannedStatement{
+		{File: "002_posts.sql", Index: 0, SQL: "CREATE TABLE posts (ID INT);"},
+		{File: "002_posts.sql", Index: 1, SQL: "INSERT INTO posts VALUES (1);"},
+	}, plan)
+	assert.Empty(t, state.executedStatements(), "nothing is executed")
+
+	require.NoError(t, db.Migrate(context.Background()))
+	assert.Equal(t, []string{plan[0].SQL, plan[1].SQL}, state.executedStatements(), "the plan is what runs")
+	plan, err = db.MigrationPlan()
+	require.NoError(t, err)
+	assert.Empty(t, plan)
+}
+
+func TestTransactionalDML(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte(`CREATE TABLE users (ID INT);
+INSERT INTO users VALUES (1);
+-- the admin user
+UPDATE users SET ID = 2 WHERE ID = 1;
+ALTER TABLE users ADD Name TEXT;
+/* backfill */ DELETE FROM users;`)},
+	}
+	state := newFakeMigrationState()
+	srv := newFakeServer(t, state.handle)
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+	WithTransactionalDML()(db)
+
+	require.NoError(t, db.runMigrations(context.Background()))
+	queries := srv.queries()
+	assert.Equal(t, []string{
+		"CREATE TABLE users (ID INT);",
+		"BEGIN",
+		"INSERT INTO users VALUES (1);",
+		"-- the admin user\nUPDATE users SET ID = 2 WHERE ID = 1;",
+		"COMMIT",
+		"ALTER TABLE users ADD Name TEXT;",
+		"BEGIN",
+		"/* backfill */ DELETE FROM users;",
+		"COMMIT",
+	}, queries[2:len(queries)-1])
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+}
+
+func TestTransactionalDMLRollsBackRun(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);\nINSERT INTO users VALUES (1);\nINSERT INTO users VALUES (1);\nALTER TABLE users ADD Name TEXT;")},
+	}
+	state := newFakeMigrationState()
+	inserts := 0
+	errDup := errors.New("duplicate entry")
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.HasPrefix(q.query, "INSERT INTO users") {
+			if inserts++; inserts == 2 {
+				return fakeResult{}, errDup
+			}
+		}
+		return state.handle(q)
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+	WithMigrations(fsys, "migrations")(db)
+	WithTransactionalDML()(db)
+
+	assert.ErrorIs(t, db.runMigrations(context.Background()), errDup)
+	queries := srv.queries()
+	assert.Equal(t, []string{
+		"CREATE TABLE users (ID INT);",
+		"BEGIN",
+		"INSERT INTO users VALUES (1);",
+		"INSERT INTO users VALUES (1);",
+		"ROLLBACK",
+	}, queries[len(queries)-5:])
+	assert.Empty(t, state.applied)
+}
+
+func TestIsDML(t *testing.T) {
+	tests := map[string]bool{
+		"INSERT INTO t VALUES (1);":        true,
+		"  update t SET a = 1;":            true,
+		"-- comment\nDELETE FROM t;":       true,
+		"# comment\nREPLACE INTO t VALUES": true,
+		"/* a */ /* b */INSERT INTO t":     true,
+		"CREATE TABLE t (ID INT);":         false,
+		"ALTER TABLE t ADD c INT;":         false,
+		"INSERTS":                          false,
+		"SET @a = 1;":                      false,
+		"":                                 false,
+		"-- only a comment":                false,
+	}
+	for stmt, want := range tests {
+		assert.Equal(t, want, isDML(stmt), stmt)
+	}
+}
@@ -0,0 +1,256 @@
+// Package mysqldbtest provides helpers for testing code that depends on
+// the mysqldb package.
+package mysqldbtest
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/gavinwade12/mysqldb"
+)
+
+// Call is a call made to a FakeConn.
+type Call struct {
+	// Method is Exec, Query or QueryRow.
+	Method string
+	Query  string
+	Args   []interface{}
+}
+
+// Result is a sql.Result returned by a FakeConn.
+type Result struct {
+	LastID   int64
+	Affected int64
+}
+
+func (r Result) LastInsertId() (int64, error) { return r.LastID, nil }
+func (r Result) RowsAffected() (int64, error) { return r.Affected, nil }
+
+type execResponse struct {
+	result sql.Result
+	err    error
+}
+
+type queryResponse struct {
+	rows *Rows
+	err  error
+}
+
+// FakeConn is a mysqldb.Conn that records every call made to it and
+// returns the results programmed for each query. A query that hasn't been
+// programmed fails with an error. The zero value is ready to use, and its
+// methods are safe for concurrent use.
+type FakeConn struct {
+	mu      sync.Mutex
+	calls   []Call
+	execs   map[string]execResponse
+	queries map[string]queryResponse
+}
+
+var _ mysqldb.Conn = (*FakeConn)(nil)
+
+// OnExec programs Exec to return result and err for query.
+func (c *FakeConn) OnExec(query string, result sql.Result, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.execs == nil {
+		c.execs = make(map[string]execResponse)
+	}
+	c.execs[query] = execResponse{result: result, err: err}
+}
+
+// OnQuery programs Query to return a copy of rows and err for query.
+// QueryRow returns the first of the rows, or sql.ErrNoRows if there are
+// none, or err when it's scanned.
+func (c *FakeConn) OnQuery(query string, rows *Rows, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queries == nil {
+		c.queries = make(map[string]queryResponse)
+	}
+	c.queries[query] = queryResponse{rows: rows, err: err}
+}
+
+// Calls returns the calls made so far, in order.
+func (c *FakeConn) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// Reset forgets the calls made so far. Programmed results are kept.
+func (c *FakeConn) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+func (c *FakeConn) record(method, query string, args []interface{}) {
+	c.calls = append(c.calls, Call{Method: method, Query: query, Args: args})
+}
+
+func (c *FakeConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record("Exec", query, args)
+
+	res, ok := c.execs[query]
+	if !ok {
+		return nil, fmt.Errorf("mysqldbtest: unexpected Exec: %s", query)
+	}
+	return res.result, res.err
+}
+
+func (c *FakeConn) Query(query string, args ...interface{}) (mysqldb.Rows, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record("Query", query, args)
+
+	rows, err := c.query(query)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (c *FakeConn) QueryRow(query string, args ...interface{}) mysqldb.Row {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.record("QueryRow", query, args)
+
+	rows, err := c.query(query)
+	return &row{rows: rows, err: err}
+}
+
+// query returns a copy of the rows programmed for query.
+func (c *FakeConn) query(query string) (*Rows, error) {
+	res, ok := c.queries[query]
+	if !ok {
+		return nil, fmt.Errorf("mysqldbtest: unexpected Query: %s", query)
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	if res.rows == nil {
+		return NewRows(nil), nil
+	}
+	return NewRows(res.rows.columns, res.rows.values...), nil
+}
+
+// Rows is a mysqldb.Rows over values held in memory.
+type Rows struct {
+	columns []string
+	values  [][]interface{}
+	pos     int
+	closed  bool
+}
+
+var _ mysqldb.Rows = (*Rows)(nil)
+
+// NewRows returns Rows with the given columns and rows of values.
+func NewRows(columns []string, values ...[]interface{}) *Rows {
+	return &Rows{columns: columns, values: values}
+}
+
+func (r *Rows) Next() bool {
+	if r.closed || r.pos >= len(r.values) {
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *Rows) Scan(dest ...interface{}) error {
+	if r.closed {
+		return errors.New("mysqldbtest: rows are closed")
+	}
+	if r.pos == 0 || r.pos > len(r.values) {
+		return errors.New("mysqldbtest: Scan called without calling Next")
+	}
+	return scanValues(r.values[r.pos-1], dest)
+}
+
+func (r *Rows) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *Rows) Columns() ([]string, error) {
+	if r.closed {
+		return nil, errors.New("mysqldbtest: rows are closed")
+	}
+	return r.columns, nil
+}
+
+// ErrNoColumnTypes is returned by ColumnTypes, since a sql.ColumnType can
+// only be created by database/sql. Helpers that convert values by column
+// type, such as mysqldb.ScanRowToMap and mysqldb.StreamNDJSON, can't be
+// used with a FakeConn.
+var ErrNoColumnTypes = errors.New("mysqldbtest: column types aren't supported")
+
+// ColumnTypes always returns ErrNoColumnTypes.
+func (r *Rows) ColumnTypes() ([]*sql.ColumnType, error) {
+	return nil, ErrNoColumnTypes
+}
+
+// row is the mysqldb.Row returned by QueryRow.
+type row struct {
+	rows *Rows
+	err  error
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.rows.Next() {
+		return sql.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// scanValues assigns each of values to the corresponding pointer in dest.
+// Values are assigned to a sql.Scanner with its Scan method, or converted
+// to the type pointed to. A nil value sets the zero value.
+func scanValues(values []interface{}, dest []interface{}) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("mysqldbtest: expected %d destination arguments in Scan, not %d", len(values), len(dest))
+	}
+
+	for i, v := range values {
+		if s, ok := dest[i].(sql.Scanner); ok {
+			if err := s.Scan(v); err != nil {
+				return fmt.Errorf("mysqldbtest: scanning column %d: %w", i, err)
+			}
+			continue
+		}
+
+		dv := reflect.ValueOf(dest[i])
+		if dv.Kind() != reflect.Pointer || dv.IsNil() {
+			return fmt.Errorf("mysqldbtest: destination %d is not a non-nil pointer", i)
+		}
+		dv = dv.Elem()
+
+		if v == nil {
+			dv.Set(reflect.Zero(dv.Type()))
+			continue
+		}
+
+		sv := reflect.ValueOf(v)
+		if b, ok := v.([]byte); ok && dv.Kind() == reflect.String {
+			sv = reflect.ValueOf(string(b))
+		}
+		switch {
+		case sv.Type().AssignableTo(dv.Type()):
+			dv.Set(sv)
+		case sv.Type().ConvertibleTo(dv.Type()) && sv.Kind() != reflect.String && dv.Kind() != reflect.String:
+			dv.Set(sv.Convert(dv.Type()))
+		default:
+			return fmt.Errorf("mysqldbtest: can't scan %T into %s for column %d", v, dv.Type(), i)
+		}
+	}
+	return nil
+}
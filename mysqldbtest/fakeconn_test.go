@@ -0,0 +1,125 @@
+package mysqldbtest
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/gavinwade12/mysqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeConnExec(t *testing.T) {
+	c := &FakeConn{}
+	c.OnExec("INSERT INTO users (name) VALUES (?);", Result{LastID: 7, Affected: 1}, nil)
+
+	res, err := c.Exec("INSERT INTO users (name) VALUES (?);", "gavin")
+	require.NoError(t, err)
+	id, err := res.LastInsertId()
+	require.NoError(t, err)
+	assert.EqualValues(t, 7, id)
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, affected)
+
+	errDup := errors.New("duplicate entry")
+	c.OnExec("INSERT INTO users (name) VALUES (?);", nil, errDup)
+	_, err = c.Exec("INSERT INTO users (name) VALUES (?);", "gavin")
+	assert.ErrorIs(t, err, errDup)
+
+	_, err = c.Exec("DELETE FROM users;")
+	assert.ErrorContains(t, err, "unexpected Exec: DELETE FROM users;")
+
+	assert.Equal(t, []Call{
+		{Method: "Exec", Query: "INSERT INTO users (name) VALUES (?);", Args: []interface{}{"gavin"}},
+		{Method: "Exec", Query: "INSERT INTO users (name) VALUES (?);", Args: []interface{}{"gavin"}},
+		{Method: "Exec", Query: "DELETE FROM users;"},
+	}, c.Calls())
+
+	c.Reset()
+	assert.Empty(t, c.Calls())
+}
+
+func TestFakeConnQuery(t *testing.T) {
+	c := &FakeConn{}
+	c.OnQuery("SELECT id, name FROM users;", NewRows([]string{"id", "name"},
+		[]interface{}{int64(1), []byte("gavin")},
+		[]interface{}{int64(2), nil},
+	), nil)
+
+	for i := 0; i < 2; i++ {
+		rows, err := c.Query("SELECT id, name FROM users;")
+		require.NoError(t, err)
+
+		columns, err := rows.Columns()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"id", "name"}, columns)
+
+		var (
+			ids   []int
+			names []sql.NullString
+		)
+		for rows.Next() {
+			var (
+				id   int
+				name sql.NullString
+			)
+			require.NoError(t, rows.Scan(&id, &name))
+			ids = append(ids, id)
+			names = append(names, name)
+		}
+		require.NoError(t, rows.Close())
+		assert.Equal(t, []int{1, 2}, ids, "the rows are replayed on every call")
+		assert.Equal(t, []sql.NullString{{String: "gavin", Valid: true}, {}}, names)
+	}
+
+	errTimeout := errors.New("timeout")
+	c.OnQuery("SELECT 1;", nil, errTimeout)
+	_, err := c.Query("SELECT 1;")
+	assert.ErrorIs(t, err, errTimeout)
+	assert.Len(t, c.Calls(), 3)
+	assert.Equal(t, "Query", c.Calls()[2].Method)
+}
+
+func TestFakeConnQueryRow(t *testing.T) {
+	c := &FakeConn{}
+	c.OnQuery("SELECT name FROM users WHERE id = ?;", NewRows([]string{"name"}, []interface{}{"gavin"}), nil)
+	c.OnQuery("SELECT name FROM users WHERE id = 0;", NewRows([]string{"name"}), nil)
+
+	var name string
+	require.NoError(t, c.QueryRow("SELECT name FROM users WHERE id = ?;", 1).Scan(&name))
+	assert.Equal(t, "gavin", name)
+
+	assert.ErrorIs(t, c.QueryRow("SELECT name FROM users WHERE id = 0;").Scan(&name), sql.ErrNoRows)
+	assert.ErrorContains(t, c.QueryRow("SELECT 1;").Scan(&name), "unexpected Query")
+
+	var n int
+	assert.Error(t, c.QueryRow("SELECT name FROM users WHERE id = ?;", 1).Scan(&n))
+
+	assert.Equal(t, Call{Method: "QueryRow", Query: "SELECT name FROM users WHERE id = ?;", Args: []interface{}{1}}, c.Calls()[0])
+}
+
+func TestFakeConnWithHelpers(t *testing.T) {
+	c := &FakeConn{}
+	c.OnQuery("SELECT id FROM users;", NewRows([]string{"id"}, []interface{}{int64(1)}, []interface{}{int64(2)}), nil)
+
+	ids, err := mysqldb.QueryColumn[int64](c, "SELECT id FROM users;")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+}
+
+func TestFakeConnColumnTypes(t *testing.T) {
+	c := &FakeConn{}
+	c.OnQuery("SELECT id, name FROM users;", NewRows([]string{"id", "name"}, []interface{}{int64(1), "gavin"}), nil)
+
+	rows, err := c.Query("SELECT id, name FROM users;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	require.NotPanics(t, func() {
+		_, err = mysqldb.ScanRowToMap(rows)
+	})
+	assert.ErrorIs(t, err, ErrNoColumnTypes)
+}
@@ -0,0 +1,269 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// reconnectBackoff is the delay before the first reconnect attempt. It
+// doubles after every failed attempt.
+var reconnectBackoff = 50 * time.Millisecond
+
+// WithAutoReconnect returns an option that will configure the DB to
+// recover from bad connections, such as those left behind by a failover.
+// When a statement fails with a bad connection, the pool is pinged with
+// exponential backoff for up to max, and re-opened entirely if the ping
+// fails. The statement is retried once after a successful reconnect.
+func WithAutoReconnect(max time.Duration) Option {
+	return func(db *DB) {
+		db.reconnectMax = max
+	}
+}
+
+// WithReconnectJitter returns an option that will configure the DB to
+// randomize each delay between reconnect attempts made for
+// WithAutoReconnect to anywhere from zero up to the exponential backoff,
+// in the same way as WithJitter does for RetryReads. It stops a fleet of
+// clients from reconnecting in lockstep after a server restart.
+func WithReconnectJitter() Option {
+	return func(db *DB) {
+		db.reconnectJitter = true
+	}
+}
+
+// reconnectWait returns how long to wait before the next reconnect
+// attempt for delay, the current exponential backoff.
+func (db *DB) reconnectWait(delay time.Duration) time.Duration {
+	if !db.reconnectJitter {
+		return delay
+	}
+	if db.reconnectRand != nil {
+		return fullJitter(delay, db.reconnectRand)
+	}
+	return fullJitter(delay, rand.Int63n)
+}
+
+// WithRecreateOnUnknownDatabase returns an option that will configure the
+// DB to recover from its database being dropped while it's in use. When a
+// statement fails because the database is unknown, MySQL error 1049, the
+// database is created again, the pool is re-opened, and the migrations
+// are run, before the statement is retried once. Statements that fail
+// while the database is being recreated, including the migrations
+// themselves, aren't retried, so a database that can't be recreated
+// doesn't cause a loop.
+func WithRecreateOnUnknownDatabase() Option {
+	return func(db *DB) {
+		db.recreateOnUnknownDB = true
+	}
+}
+
+// isUnknownDatabase reports whether err is MySQL's unknown database error.
+func isUnknownDatabase(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1049
+}
+
+// errRecreating is returned by recreateMissingDatabase when the database
+// is already being recreated.
+var errRecreating = errors.New("database is already being recreated")
+
+// recreateMissingDatabase creates the DB's database, which has been
+// dropped, re-opens the pool and runs the migrations.
+func (db *DB) recreateMissingDatabase() error {
+	if !db.recreating.CompareAndSwap(false, true) {
+		return errRecreating
+	}
+	defer db.recreating.Store(false)
+
+	cfg, err := mysql.ParseDSN(db.dsn)
+	if err != nil {
+		return fmt.Errorf("parsing dsn: %w", err)
+	}
+	cfg.DBName = ""
+	if _, err = createDatabaseIfNotExist(db.driverName, cfg.FormatDSN(), db.name, db.createCharset, db.createCollation); err != nil {
+		return fmt.Errorf("recreating database: %w", err)
+	}
+
+	if err = db.reopen(); err != nil {
+		return err
+	}
+
+	if db.hasMigrations() {
+		if err = db.runMigrations(context.Background()); err != nil {
+			return fmt.Errorf("running migrations: %w", err)
+		}
+	}
+	return nil
+}
+
+// retryUnknownDatabase recreates the database if err shows it's unknown
+// and recreating is enabled. It reports whether the failed statement
+// should be retried, or returns the error recreating the database.
+func (db *DB) retryUnknownDatabase(err error) (bool, error) {
+	if !db.recreateOnUnknownDB || !isUnknownDatabase(err) {
+		return false, nil
+	}
+	if rerr := db.recreateMissingDatabase(); rerr != nil {
+		if errors.Is(rerr, errRecreating) {
+			return false, nil
+		}
+		return false, fmt.Errorf("recovering from %v: %w", err, rerr)
+	}
+	return true, nil
+}
+
+// isBadConn reports whether err indicates the connection is unusable.
+func isBadConn(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn)
+}
+
+// withReconnect runs fn against the current pool, reconnecting and
+// running it again if it fails with a bad connection.
+func (db *DB) withReconnect(fn func(*sql.DB) error) error {
+	err := db.usePool(fn)
+	if retry, rerr := db.retryUnknownDatabase(err); rerr != nil {
+		return rerr
+	} else if retry {
+		return db.usePool(fn)
+	}
+
+	if db.reconnectMax <= 0 || !isBadConn(err) {
+		return err
+	}
+
+	if err = db.reconnect(); err != nil {
+		return err
+	}
+	return db.usePool(fn)
+}
+
+// acquirePool returns the current pool, which won't be closed by a swap
+// until the returned func is called. Rows and transactions started on the
+// pool before then may outlive it, since closing a pool waits for the
+// connections in use to be released.
+func (db *DB) acquirePool() (*sql.DB, func()) {
+	db.dbMu.RLock()
+	defer db.dbMu.RUnlock()
+
+	v, _ := db.poolUsers.LoadOrStore(db.db, new(sync.WaitGroup))
+	users := v.(*sync.WaitGroup)
+	users.Add(1)
+	return db.db, users.Done
+}
+
+// usePool runs fn with the current pool, acquired for the duration.
+func (db *DB) usePool(fn func(*sql.DB) error) error {
+	sdb, release := db.acquirePool()
+	defer release()
+	return fn(sdb)
+}
+
+// swapPool replaces the underlying pool with sdb. The session connection,
+// which belongs to the old pool, is closed so the next use opens one from
+// sdb. The old pool is closed in the background, once the statements
+// started on it have returned.
+func (db *DB) swapPool(sdb *sql.DB) {
+	db.sessionMu.Lock()
+	db.dbMu.Lock()
+	old := db.db
+	db.db = sdb
+	db.dbMu.Unlock()
+	if err := db.dropSession(); err != nil {
+		db.log().Printf("mysqldb: %v", err)
+	}
+	db.sessionMu.Unlock()
+
+	// no more users are added once old has been swapped out
+	v, ok := db.poolUsers.LoadAndDelete(old)
+	go func() {
+		if ok {
+			v.(*sync.WaitGroup).Wait()
+		}
+		if err := old.Close(); err != nil {
+			db.log().Printf("mysqldb: closing replaced pool: %v", err)
+		}
+	}()
+}
+
+// reconnect pings the pool with exponential backoff until it responds
+// or reconnectMax has elapsed, re-opening the pool after a failed ping.
+func (db *DB) reconnect() error {
+	db.reconnectMu.Lock()
+	defer db.reconnectMu.Unlock()
+
+	deadline := time.Now().Add(db.reconnectMax)
+	delay := reconnectBackoff
+	for {
+		err := db.usePool(func(sdb *sql.DB) error { return sdb.Ping() })
+		if err == nil {
+			return nil
+		}
+
+		if oerr := db.reopen(); oerr != nil {
+			err = oerr
+		}
+
+		wait := db.reconnectWait(delay)
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("reconnecting: %w", err)
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// reopen replaces the underlying pool with a newly opened one.
+func (db *DB) reopen() error {
+	sdb, err := db.openPool()
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	db.swapPool(sdb)
+	return nil
+}
+
+// reconnectRow is a Row that reconnects and re-runs its query if
+// scanning fails with a bad connection, or recreates the database and
+// re-runs it if the database is unknown.
+type reconnectRow struct {
+	db    *DB
+	row   *sql.Row
+	ctx   context.Context
+	query string
+	args  []interface{}
+}
+
+func (r *reconnectRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if retry, rerr := r.db.retryUnknownDatabase(err); rerr != nil {
+		return rerr
+	} else if retry {
+		return r.rerun(dest...)
+	}
+
+	if r.db.reconnectMax <= 0 || !isBadConn(err) {
+		return err
+	}
+
+	if err = r.db.reconnect(); err != nil {
+		return err
+	}
+	return r.rerun(dest...)
+}
+
+// rerun runs the row's query again on the current pool, with the context
+// it was first run with, and scans it.
+func (r *reconnectRow) rerun(dest ...interface{}) error {
+	sdb, release := r.db.acquirePool()
+	row := sdb.QueryRowContext(r.ctx, r.query, r.args...)
+	release()
+	return row.Scan(dest...)
+}
@@ -0,0 +1,339 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAutoReconnectOption(t *testing.T) {
+	db := &DB{}
+	WithAutoReconnect(time.Second)(db)
+	assert.Equal(t, time.Second, db.reconnectMax)
+}
+
+func TestAutoReconnectRecovers(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		down  = true
+		pings int
+	)
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			return fakeResult{}, driver.ErrBadConn
+		}
+		return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(1)}}, affected: 1}, nil
+	})
+	srv.ping = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		pings++
+		if pings > 2 {
+			down = false
+			return nil
+		}
+		return driver.ErrBadConn
+	}
+
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("test")}
+	WithAutoReconnect(5 * time.Second)(db)
+	t.Cleanup(func() { db.sqlDB().Close() })
+
+	_, err := db.Exec("UPDATE t SET n = 1;")
+	require.NoError(t, err)
+
+	mu.Lock()
+	down, pings = true, 0
+	mu.Unlock()
+
+	var n int64
+	require.NoError(t, db.QueryRow("SELECT n FROM t;").Scan(&n))
+	assert.EqualValues(t, 1, n)
+}
+
+// A QueryRowContext row that's re-run after reconnecting keeps its
+// context.
+func TestAutoReconnectRowKeepsContext(t *testing.T) {
+	type ctxKey struct{}
+	var (
+		mu       sync.Mutex
+		failures int
+		values   []interface{}
+	)
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if q.query == "SELECT n FROM t;" {
+			values = append(values, q.ctx.Value(ctxKey{}))
+		}
+		if failures > 0 {
+			failures--
+			return fakeResult{}, driver.ErrBadConn
+		}
+		return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(1)}}}, nil
+	})
+
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("test")}
+	WithAutoReconnect(5 * time.Second)(db)
+	t.Cleanup(func() { db.sqlDB().Close() })
+
+	// database/sql retries a bad connection itself before giving up
+	mu.Lock()
+	failures = 3
+	mu.Unlock()
+
+	var n int64
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	require.NoError(t, db.QueryRowContext(ctx, "SELECT n FROM t;").Scan(&n))
+	assert.EqualValues(t, 1, n)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.NotEmpty(t, values)
+	for _, v := range values {
+		assert.Equal(t, "request", v)
+	}
+	assert.Len(t, values, 4, "the query was re-run after reconnecting")
+}
+
+func TestAutoReconnectGivesUp(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{}, driver.ErrBadConn
+	})
+	srv.ping = func() error { return driver.ErrBadConn }
+
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("test")}
+	WithAutoReconnect(100 * time.Millisecond)(db)
+	t.Cleanup(func() { db.sqlDB().Close() })
+
+	_, err := db.Exec("UPDATE t SET n = 1;")
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+}
+
+func TestWithReconnectJitterOption(t *testing.T) {
+	db := &DB{}
+	WithReconnectJitter()(db)
+	assert.True(t, db.reconnectJitter)
+}
+
+func TestReconnectJitter(t *testing.T) {
+	db := &DB{}
+	WithReconnectJitter()(db)
+	db.reconnectRand = rand.New(rand.NewSource(1)).Int63n
+
+	seen := map[time.Duration]bool{}
+	for delay := reconnectBackoff; delay <= 8*reconnectBackoff; delay *= 2 {
+		for i := 0; i < 100; i++ {
+			wait := db.reconnectWait(delay)
+			assert.GreaterOrEqual(t, wait, time.Duration(0))
+			assert.Less(t, wait, delay)
+			seen[wait] = true
+		}
+	}
+	assert.Greater(t, len(seen), 300, "delays are randomized")
+
+	plain := &DB{}
+	assert.Equal(t, 4*reconnectBackoff, plain.reconnectWait(4*reconnectBackoff))
+}
+
+func TestAutoReconnectWithJitter(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{}, driver.ErrBadConn
+	})
+	srv.ping = func() error { return driver.ErrBadConn }
+
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("test")}
+	WithAutoReconnect(300 * time.Millisecond)(db)
+	WithReconnectJitter()(db)
+	var (
+		mu      sync.Mutex
+		backoff []time.Duration
+	)
+	db.reconnectRand = func(n int64) int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		backoff = append(backoff, time.Duration(n))
+		return n / 4
+	}
+	t.Cleanup(func() { db.sqlDB().Close() })
+
+	_, err := db.Exec("UPDATE t SET n = 1;")
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(backoff), 3)
+	for i, d := range backoff {
+		assert.Equal(t, reconnectBackoff<<i, d, "the jittered backoff still doubles")
+	}
+}
+
+// droppedDatabaseHandler fails every statement with an unknown database
+// error while the database is dropped, until it's created again. Counts
+// are always zero, and other statements are handled by state. If recreatable is false, creating the
+// database has no effect. The returned func counts the creations.
+func droppedDatabaseHandler(state *fakeMigrationState, recreatable bool) (func(q fakeQuery) (fakeResult, error), func(bool), func() int) {
+	var (
+		mu      sync.Mutex
+		dropped bool
+		creates int
+	)
+	handler := func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		if strings.HasPrefix(q.query, "CREATE DATABASE IF NOT EXISTS") {
+			creates++
+			if dropped && recreatable {
+				dropped = false
+				mu.Unlock()
+				return fakeResult{affected: 1}, nil
+			}
+			mu.Unlock()
+			return fakeResult{}, nil
+		}
+		if dropped {
+			mu.Unlock()
+			return fakeResult{}, &mysql.MySQLError{Number: 1049, Message: "Unknown database 'app'"}
+		}
+		mu.Unlock()
+		if strings.HasPrefix(q.query, "SELECT COUNT(*)") {
+			return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(0)}}}, nil
+		}
+		return state.handle(q)
+	}
+	drop := func(d bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		dropped = d
+		if d {
+			state.mu.Lock()
+			state.applied = nil
+			state.mu.Unlock()
+		}
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return creates
+	}
+	return handler, drop, count
+}
+
+func TestRecreateOnUnknownDatabase(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	state := newFakeMigrationState()
+	handler, drop, creates := droppedDatabaseHandler(state, true)
+	srv := newFakeServer(t, handler)
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithRecreateOnUnknownDatabase())
+	require.NoError(t, err)
+	defer db.Close()
+	state.executedStatements()
+
+	drop(true)
+	_, err = db.Exec("INSERT INTO users VALUES (1);")
+	require.NoError(t, err)
+	assert.Equal(t, 1, creates())
+	assert.Equal(t, []string{"CREATE TABLE users (ID INT);", "INSERT INTO users VALUES (1);"}, state.executedStatements())
+	assert.Equal(t, []string{"001_users.sql"}, state.applied)
+
+	drop(true)
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM users;").Scan(&n))
+	assert.Equal(t, 2, creates())
+}
+
+func TestRecreateOnUnknownDatabaseGivesUp(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/001_users.sql": &fstest.MapFile{Data: []byte("CREATE TABLE users (ID INT);")},
+	}
+	state := newFakeMigrationState()
+	handler, drop, creates := droppedDatabaseHandler(state, false)
+	srv := newFakeServer(t, handler)
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), WithMigrations(fsys, "migrations"), WithRecreateOnUnknownDatabase())
+	require.NoError(t, err)
+	defer db.Close()
+
+	drop(true)
+	_, err = db.Exec("INSERT INTO users VALUES (1);")
+	assert.True(t, isUnknownDatabase(err), "%v", err)
+	assert.Equal(t, 1, creates(), "the database is only recreated once")
+}
+
+func TestUnknownDatabaseWithoutOption(t *testing.T) {
+	state := newFakeMigrationState()
+	handler, drop, creates := droppedDatabaseHandler(state, true)
+	srv := newFakeServer(t, handler)
+
+	db, err := NewDB(srv.dsn("app"), withFakeDriver())
+	require.NoError(t, err)
+	defer db.Close()
+
+	drop(true)
+	_, err = db.Exec("INSERT INTO users VALUES (1);")
+	assert.True(t, isUnknownDatabase(err), "%v", err)
+	assert.Zero(t, creates())
+}
+
+func TestReopenWaitsForPoolUsers(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("test")}
+	t.Cleanup(func() { db.sqlDB().Close() })
+
+	old, release := db.acquirePool()
+	require.NoError(t, db.reopen())
+	assert.NotSame(t, old, db.sqlDB())
+	assert.NoError(t, old.Ping(), "the old pool stays open while it's in use")
+
+	release()
+	assert.Eventually(t, func() bool { return old.Ping() != nil }, time.Second, time.Millisecond, "the old pool is closed once released")
+}
+
+func TestReopenReplacesSession(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conns = map[string][]int{}
+	)
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		conns[q.query] = append(conns[q.query], q.conn)
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t), driverName: fakeDriverName, dsn: srv.dsn("app"), name: "app"}
+	t.Cleanup(func() { db.Close() })
+
+	require.NoError(t, db.UseDatabase("reporting"))
+	before, err := db.Session()
+	require.NoError(t, err)
+	_, err = before.Exec("SET @a = 1;")
+	require.NoError(t, err)
+
+	require.NoError(t, db.reopen())
+
+	after, err := db.Session()
+	require.NoError(t, err)
+	_, err = after.Exec("SET @a = 1;")
+	require.NoError(t, err, "the session isn't left on the closed pool")
+	require.NoError(t, db.WithoutForeignKeyChecks(func(Conn) error { return nil }))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, conns["SET @a = 1;"], 2)
+	assert.NotEqual(t, conns["SET @a = 1;"][0], conns["SET @a = 1;"][1], "a new session connection is opened")
+	assert.Len(t, conns["USE `reporting`;"], 2, "the new session is switched to the selected database")
+	assert.Equal(t, "reporting", db.database())
+}
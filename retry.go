@@ -0,0 +1,138 @@
+package mysqldb
+
+import (
+	"database/sql"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// isTransientError reports whether err is likely to succeed if the
+// statement is retried: a bad connection, a deadlock, or a lock wait
+// timeout.
+func isTransientError(err error) bool {
+	if isBadConn(err) {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, // lock wait timeout exceeded
+			1213: // deadlock found when trying to get lock
+			return true
+		}
+	}
+	return false
+}
+
+// retryConn is a Conn that retries reads that fail with transient errors.
+type retryConn struct {
+	c        Conn
+	attempts int
+	backoff  time.Duration
+	jitter   bool
+
+	// rand returns a random number in [0, n) for jitter. It's replaced in
+	// tests for deterministic delays.
+	rand func(n int64) int64
+}
+
+// RetryOption configures a Conn returned by RetryReads.
+type RetryOption func(*retryConn)
+
+// WithJitter returns a RetryOption that randomizes each delay between
+// attempts to anywhere from zero up to the exponential backoff, known as
+// full jitter. It stops clients that failed together, such as after a
+// failover, from retrying in lockstep.
+func WithJitter() RetryOption {
+	return func(c *retryConn) {
+		c.jitter = true
+	}
+}
+
+// RetryReads returns a Conn that retries Query and QueryRow up to attempts
+// times in total when they fail with a transient error, such as a bad
+// connection or a deadlock. The delay between attempts starts at backoff
+// and doubles after each one. Exec is never retried, since it's not safe
+// to assume a failed write had no effect. Rows are only retried until
+// Query returns, not while they're being iterated.
+func RetryReads(c Conn, attempts int, backoff time.Duration, options ...RetryOption) Conn {
+	if attempts < 1 {
+		attempts = 1
+	}
+	rc := &retryConn{c: c, attempts: attempts, backoff: backoff, rand: rand.Int63n}
+	for _, o := range options {
+		o(rc)
+	}
+	return rc
+}
+
+// wait returns how long to wait before the next attempt for delay, the
+// current exponential backoff.
+func (c *retryConn) wait(delay time.Duration) time.Duration {
+	if !c.jitter {
+		return delay
+	}
+	return fullJitter(delay, c.rand)
+}
+
+// fullJitter returns a random delay from zero up to delay, using rand to
+// return a random number in [0, n).
+func fullJitter(delay time.Duration, rand func(n int64) int64) time.Duration {
+	if delay <= 0 {
+		return delay
+	}
+	return time.Duration(rand(int64(delay)))
+}
+
+// retry calls fn until it succeeds, fails with a non-transient error, or
+// has been called the configured number of times.
+func (c *retryConn) retry(fn func() error) error {
+	delay := c.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= c.attempts || !isTransientError(err) {
+			return err
+		}
+
+		time.Sleep(c.wait(delay))
+		delay *= 2
+	}
+}
+
+func (c *retryConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.c.Exec(query, args...)
+}
+
+func (c *retryConn) Query(query string, args ...interface{}) (Rows, error) {
+	var rows Rows
+	err := c.retry(func() (err error) {
+		rows, err = c.c.Query(query, args...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (c *retryConn) QueryRow(query string, args ...interface{}) Row {
+	return &retryRow{c: c, query: query, args: args}
+}
+
+// retryRow runs its query when scanned, retrying it on transient errors.
+type retryRow struct {
+	c     *retryConn
+	query string
+	args  []interface{}
+}
+
+func (r *retryRow) Scan(dest ...interface{}) error {
+	return r.c.retry(func() error {
+		return r.c.c.QueryRow(r.query, r.args...).Scan(dest...)
+	})
+}
@@ -0,0 +1,103 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errDeadlock = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+// flakyHandler fails the first failures statements of each kind with a
+// deadlock, and counts every statement received by kind.
+func flakyHandler(failures int) (func(q fakeQuery) (fakeResult, error), map[string]int) {
+	var mu sync.Mutex
+	counts := map[string]int{}
+	return func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		kind := strings.Fields(q.query)[0]
+		counts[kind]++
+		if counts[kind] <= failures {
+			return fakeResult{}, errDeadlock
+		}
+		return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(1)}}, affected: 1}, nil
+	}, counts
+}
+
+func TestRetryReads(t *testing.T) {
+	handler, counts := flakyHandler(2)
+	srv := newFakeServer(t, handler)
+	c := RetryReads(&DB{db: srv.open(t)}, 3, time.Millisecond)
+
+	rows, err := c.Query("SELECT n FROM t;")
+	require.NoError(t, err)
+	require.NoError(t, rows.Close())
+	assert.Equal(t, 3, counts["SELECT"])
+
+	counts["SELECT"] = 0
+	var n int
+	require.NoError(t, c.QueryRow("SELECT n FROM t;").Scan(&n))
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 3, counts["SELECT"])
+}
+
+func TestRetryReadsGivesUp(t *testing.T) {
+	handler, counts := flakyHandler(5)
+	srv := newFakeServer(t, handler)
+	c := RetryReads(&DB{db: srv.open(t)}, 3, time.Millisecond)
+
+	_, err := c.Query("SELECT n FROM t;")
+	assert.ErrorIs(t, err, errDeadlock)
+	assert.Equal(t, 3, counts["SELECT"])
+}
+
+func TestRetryReadsNeverRetriesWrites(t *testing.T) {
+	handler, counts := flakyHandler(1)
+	srv := newFakeServer(t, handler)
+	c := RetryReads(&DB{db: srv.open(t)}, 3, time.Millisecond)
+
+	_, err := c.Exec("UPDATE t SET n = 1;")
+	assert.ErrorIs(t, err, errDeadlock)
+	assert.Equal(t, 1, counts["UPDATE"])
+}
+
+func TestRetryReadsJitter(t *testing.T) {
+	c := RetryReads(nil, 5, 100*time.Millisecond, WithJitter()).(*retryConn)
+	c.rand = rand.New(rand.NewSource(1)).Int63n
+
+	seen := map[time.Duration]bool{}
+	for delay := 100 * time.Millisecond; delay <= 800*time.Millisecond; delay *= 2 {
+		for i := 0; i < 100; i++ {
+			wait := c.wait(delay)
+			assert.GreaterOrEqual(t, wait, time.Duration(0))
+			assert.Less(t, wait, delay)
+			seen[wait] = true
+		}
+	}
+	assert.Greater(t, len(seen), 300, "delays are randomized")
+
+	plain := RetryReads(nil, 5, 100*time.Millisecond).(*retryConn)
+	assert.Equal(t, 400*time.Millisecond, plain.wait(400*time.Millisecond))
+}
+
+func TestRetryReadsWithJitter(t *testing.T) {
+	handler, counts := flakyHandler(2)
+	srv := newFakeServer(t, handler)
+	c := RetryReads(&DB{db: srv.open(t)}, 3, 20*time.Millisecond, WithJitter()).(*retryConn)
+	c.rand = func(n int64) int64 { return n / 4 }
+
+	start := time.Now()
+	var n int
+	require.NoError(t, c.QueryRow("SELECT n FROM t;").Scan(&n))
+	elapsed := time.Since(start)
+	assert.Equal(t, 3, counts["SELECT"])
+	assert.GreaterOrEqual(t, elapsed, 15*time.Millisecond, "waits 5ms then 10ms")
+}
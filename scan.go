@@ -0,0 +1,413 @@
+package mysqldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rowColumns returns the column names of rows.
+func rowColumns(rows Rows) ([]string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("reading columns: %w", err)
+	}
+	return columns, nil
+}
+
+// rowColumnTypes returns the database type name of each of the given
+// columns of rows. It's an error for rows to report a type for fewer, or
+// more, columns than it has.
+func rowColumnTypes(rows Rows, columns []string) ([]string, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("reading column types: %w", err)
+	}
+	if len(types) != len(columns) {
+		return nil, fmt.Errorf("reading column types: got %d types for %d columns", len(types), len(columns))
+	}
+
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.DatabaseTypeName()
+	}
+	return names, nil
+}
+
+// mysqlTimeLayouts are the text formats MySQL uses for date and time values.
+var mysqlTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02",
+}
+
+// ScanRowToMap scans the current row of rows into a map keyed by column
+// name. NULLs are returned as nil. Otherwise, the column's database type
+// picks the Go type of the value: int64 (or uint64 if unsigned) for
+// integers, float64 for floating point numbers, time.Time for dates and
+// datetimes, []byte for binary strings, and string for everything else,
+// including DECIMALs so no precision is lost.
+func ScanRowToMap(rows Rows) (map[string]interface{}, error) {
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	types, err := rowColumnTypes(rows, columns)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		v, err := convertColumn(values[i], types[i])
+		if err != nil {
+			return nil, fmt.Errorf("converting column %s: %w", column, err)
+		}
+		m[column] = v
+	}
+
+	return m, nil
+}
+
+// convertColumn converts a value scanned from a column of the given
+// database type into the Go type described by ScanRowToMap.
+func convertColumn(v interface{}, typeName string) (interface{}, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return v, nil
+	}
+
+	s := string(b)
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		return strconv.ParseInt(s, 10, 64)
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		return strconv.ParseUint(s, 10, 64)
+	case "FLOAT", "DOUBLE":
+		return strconv.ParseFloat(s, 64)
+	case "DATE", "DATETIME", "TIMESTAMP":
+		return parseMySQLTime(s)
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return b, nil
+	}
+
+	return s, nil
+}
+
+// parseMySQLTime parses a DATE, DATETIME, or TIMESTAMP value in UTC. A
+// zero date, such as 0000-00-00, is returned as the zero time.Time.
+func parseMySQLTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+
+	var err error
+	for _, layout := range mysqlTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// ScanSlice scans the current row of rows into a slice holding a value
+// for each column, as returned by the driver, which is convenient for
+// debugging. Text columns are typically returned as []byte and NULLs as
+// nil. Use ScanRowToMap for values converted by column type.
+func ScanSlice(rows Rows) ([]interface{}, error) {
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// ScanByName scans the current row of rows into dest, a map of column
+// name to the pointer its value is scanned into, so the scan doesn't
+// depend on the order of the columns. It's an error for a column to have
+// no entry in dest, or for an entry to have no column.
+func ScanByName(rows Rows, dest map[string]interface{}) error {
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return err
+	}
+
+	ptrs := make([]interface{}, len(columns))
+	found := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		ptr, ok := dest[column]
+		if !ok {
+			return fmt.Errorf("column %s has no destination", column)
+		}
+		ptrs[i] = ptr
+		found[column] = true
+	}
+
+	var missing []string
+	for name := range dest {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("no columns for destinations: %s", strings.Join(missing, ", "))
+	}
+
+	return rows.Scan(ptrs...)
+}
+
+// QueryColumn runs query and returns the first column of every row it
+// returns, scanned into a T. Any other columns are ignored.
+func QueryColumn[T any](c Conn, query string, args ...interface{}) ([]T, error) {
+	rows, err := c.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	dest, err := firstColumnDest(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]T, 0)
+	for rows.Next() {
+		v, err := scanFirstColumn[T](rows, dest)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if err = rowsErr(rows); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+	return values, nil
+}
+
+// ErrNotFound is returned by QueryScalar when its query returns no rows.
+var ErrNotFound = errors.New("no rows found")
+
+// QueryScalar runs query and returns the first column of the first row it
+// returns, scanned into a T, such as the result of SELECT COUNT(*). It
+// returns ErrNotFound if the query returns no rows. Use QueryScalarOrZero
+// to treat no rows as the zero value instead.
+func QueryScalar[T any](c Conn, query string, args ...interface{}) (T, error) {
+	v, found, err := queryScalar[T](c, query, args)
+	if err == nil && !found {
+		err = ErrNotFound
+	}
+	return v, err
+}
+
+// QueryScalarOrZero is like QueryScalar, but returns the zero value of T
+// without an error if the query returns no rows.
+func QueryScalarOrZero[T any](c Conn, query string, args ...interface{}) (T, error) {
+	v, _, err := queryScalar[T](c, query, args)
+	return v, err
+}
+
+// queryScalar runs query and scans the first column of the first row it
+// returns into a T. It reports false if the query returns no rows.
+func queryScalar[T any](c Conn, query string, args []interface{}) (T, bool, error) {
+	var zero T
+	rows, err := c.Query(query, args...)
+	if err != nil {
+		return zero, false, fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	dest, err := firstColumnDest(rows)
+	if err != nil {
+		return zero, false, err
+	}
+
+	if !rows.Next() {
+		if err = rowsErr(rows); err != nil {
+			return zero, false, fmt.Errorf("iterating rows: %w", err)
+		}
+		return zero, false, nil
+	}
+	v, err := scanFirstColumn[T](rows, dest)
+	if err != nil {
+		return zero, false, err
+	}
+	return v, true, nil
+}
+
+// firstColumnDest returns scan destinations for the columns of rows,
+// discarding every column but the first, which scanFirstColumn fills in.
+func firstColumnDest(rows Rows) ([]interface{}, error) {
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("query returned no columns")
+	}
+
+	dest := make([]interface{}, len(columns))
+	for i := 1; i < len(dest); i++ {
+		dest[i] = new(interface{})
+	}
+	return dest, nil
+}
+
+// singleColumnDest is firstColumnDest for rows that must have exactly one
+// column, so that a T meant to hold a whole row, such as a struct, isn't
+// given just the first column.
+func singleColumnDest(rows Rows) ([]interface{}, error) {
+	dest, err := firstColumnDest(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(dest) != 1 {
+		return nil, fmt.Errorf("query returned %d columns, but only a single column can be scanned; use QueryStructs to scan whole rows", len(dest))
+	}
+	return dest, nil
+}
+
+// scanFirstColumn scans the first column of the current row of rows into
+// a T, using dest from firstColumnDest.
+func scanFirstColumn[T any](rows Rows, dest []interface{}) (T, error) {
+	var v T
+	dest[0] = &v
+	if err := rows.Scan(dest...); err != nil {
+		return v, fmt.Errorf("scanning row: %w", err)
+	}
+	return v, nil
+}
+
+// QueryBatches runs query and calls fn with the rows it returns, batchSize
+// rows at a time. The query must return a single column, which is
+// scanned into a T. The final batch holds any remaining rows and may be
+// smaller. Iteration stops at the first error from fn, which is returned.
+// Each batch is a new slice, so fn may keep it.
+func QueryBatches[T any](c Conn, batchSize int, fn func([]T) error, query string, args ...interface{}) error {
+	if batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	rows, err := c.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	dest, err := singleColumnDest(rows)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]T, 0, batchSize)
+	for rows.Next() {
+		v, err := scanFirstColumn[T](rows, dest)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, v)
+
+		if len(batch) == batchSize {
+			if err = fn(batch); err != nil {
+				return err
+			}
+			batch = make([]T, 0, batchSize)
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("iterating rows: %w", err)
+	}
+
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// rowsQueryerContext is implemented by a Conn that can run a query with
+// a context, such as DB.
+type rowsQueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error)
+}
+
+// QueryChan runs query and sends every row it returns on the returned
+// value channel. The query must return a single column, which is scanned
+// into a T. Both channels are closed once the rows are exhausted, after
+// any error has been sent on the error channel. Cancelling ctx stops the
+// iteration and closes the rows, and ctx's error is sent. The query
+// itself is run with ctx if c supports it.
+func QueryChan[T any](ctx context.Context, c Conn, query string, args ...interface{}) (<-chan T, <-chan error) {
+	values := make(chan T)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(values)
+
+		if err := queryChan(ctx, c, values, query, args); err != nil {
+			errs <- err
+		}
+	}()
+
+	return values, errs
+}
+
+func queryChan[T any](ctx context.Context, c Conn, values chan<- T, query string, args []interface{}) error {
+	var (
+		rows Rows
+		err  error
+	)
+	if qc, ok := c.(rowsQueryerContext); ok {
+		rows, err = qc.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = c.Query(query, args...)
+	}
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	dest, err := singleColumnDest(rows)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		v, err := scanFirstColumn[T](rows, dest)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case values <- v:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("iterating rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanRowToMap(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "big", "created", "deleted", "name", "price"},
+			types:   []string{"INT", "UNSIGNED BIGINT", "DATETIME", "DATETIME", "TEXT", "DECIMAL"},
+			rows: [][]driver.Value{{
+				[]byte("42"), []byte("18446744073709551615"), []byte("2024-01-02 03:04:05"), nil, []byte("gavin"), []byte("1.50"),
+			}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT * FROM t;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	m, err := ScanRowToMap(rows)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"id":      int64(42),
+		"big":     uint64(18446744073709551615),
+		"created": time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"deleted": nil,
+		"name":    "gavin",
+		"price":   "1.50",
+	}, m)
+}
+
+// fewerTypesRows reports a type for only the first column of its rows.
+type fewerTypesRows struct {
+	Rows
+}
+
+func (r fewerTypesRows) ColumnTypes() ([]*sql.ColumnType, error) {
+	types, err := r.Rows.ColumnTypes()
+	if err != nil || len(types) == 0 {
+		return types, err
+	}
+	return types[:1], nil
+}
+
+func TestScanRowToMapMissingColumnTypes(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "name"},
+			types:   []string{"INT", "TEXT"},
+			rows:    [][]driver.Value{{[]byte("42"), []byte("gavin")}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT * FROM t;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	_, err = ScanRowToMap(fewerTypesRows{rows})
+	assert.EqualError(t, err, "reading column types: got 1 types for 2 columns")
+}
+
+func TestScanSlice(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "name", "deleted"},
+			rows:    [][]driver.Value{{[]byte("1"), []byte("gavin"), nil}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT id, name, deleted FROM users;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	values, err := ScanSlice(rows)
+	require.NoError(t, err)
+	require.Len(t, values, 3)
+	assert.Equal(t, []interface{}{[]byte("1"), []byte("gavin"), nil}, values)
+}
+
+func TestScanByName(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"name", "id", "deleted"},
+			rows:    [][]driver.Value{{[]byte("gavin"), int64(1), nil}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT name, id, deleted FROM users;")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var (
+		id      int
+		name    string
+		deleted sql.NullTime
+	)
+	require.True(t, rows.Next())
+	require.NoError(t, ScanByName(rows, map[string]interface{}{"id": &id, "name": &name, "deleted": &deleted}))
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "gavin", name)
+	assert.False(t, deleted.Valid)
+}
+
+func TestScanByNameUnmatched(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id", "name"},
+			rows:    [][]driver.Value{{int64(1), []byte("gavin")}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	rows, err := db.Query("SELECT id, name FROM users;")
+	require.NoError(t, err)
+	defer rows.Close()
+	require.True(t, rows.Next())
+
+	var (
+		id          int
+		name, email string
+	)
+	err = ScanByName(rows, map[string]interface{}{"id": &id})
+	assert.ErrorContains(t, err, "column name has no destination")
+
+	err = ScanByName(rows, map[string]interface{}{"id": &id, "name": &name, "email": &email})
+	assert.ErrorContains(t, err, "no columns for destinations: email")
+	assert.Zero(t, id, "nothing is scanned")
+}
+
+// scalarHandler answers queries for the name of a user, which exists only
+// for the user with id 1.
+func scalarHandler(q fakeQuery) (fakeResult, error) {
+	res := fakeResult{columns: []string{"name"}}
+	if q.args[0] == int64(1) {
+		res.rows = [][]driver.Value{{"gavin"}}
+	}
+	return res, nil
+}
+
+func TestQueryScalar(t *testing.T) {
+	srv := newFakeServer(t, scalarHandler)
+	db := &DB{db: srv.open(t)}
+
+	name, err := QueryScalar[string](db, "SELECT name FROM users WHERE id = ?;", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "gavin", name)
+
+	name, err = QueryScalar[string](db, "SELECT name FROM users WHERE id = ?;", 2)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, name)
+}
+
+func TestQueryScalarOrZero(t *testing.T) {
+	srv := newFakeServer(t, scalarHandler)
+	db := &DB{db: srv.open(t)}
+
+	name, err := QueryScalarOrZero[string](db, "SELECT name FROM users WHERE id = ?;", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "gavin", name)
+
+	name, err = QueryScalarOrZero[string](db, "SELECT name FROM users WHERE id = ?;", 2)
+	require.NoError(t, err)
+	assert.Empty(t, name)
+}
+
+func TestQueryColumn(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch q.query {
+		case "SELECT id, name FROM users;":
+			return fakeResult{
+				columns: []string{"id", "name"},
+				rows:    [][]driver.Value{{int64(1), "gavin"}, {int64(2), "wade"}},
+			}, nil
+		case "SELECT name FROM users;":
+			return fakeResult{
+				columns: []string{"name"},
+				rows:    [][]driver.Value{{"gavin"}, {"wade"}},
+			}, nil
+		}
+		return fakeResult{columns: []string{"id"}}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	ids, err := QueryColumn[int64](db, "SELECT id, name FROM users;")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	names, err := QueryColumn[string](db, "SELECT name FROM users;")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gavin", "wade"}, names)
+
+	ids, err = QueryColumn[int64](db, "SELECT id FROM users WHERE id > ?;", 100)
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.NotNil(t, ids)
+}
+
+// idsHandler answers every query with an id column holding 1 to n.
+func idsHandler(n int) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		res := fakeResult{columns: []string{"id"}}
+		for i := 1; i <= n; i++ {
+			res.rows = append(res.rows, []driver.Value{int64(i)})
+		}
+		return res, nil
+	}
+}
+
+func TestQueryBatches(t *testing.T) {
+	srv := newFakeServer(t, idsHandler(7))
+	db := &DB{db: srv.open(t)}
+
+	var batches [][]int64
+	err := QueryBatches(db, 3, func(ids []int64) error {
+		batches = append(batches, ids)
+		return nil
+	}, "SELECT id FROM users;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]int64{{1, 2, 3}, {4, 5, 6}, {7}}, batches)
+}
+
+func TestQueryBatchesStopsOnError(t *testing.T) {
+	srv := newFakeServer(t, idsHandler(7))
+	db := &DB{db: srv.open(t)}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := QueryBatches(db, 3, func(ids []int64) error {
+		calls++
+		return errStop
+	}, "SELECT id FROM users;")
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
+
+func TestQueryBatchesMultipleColumns(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	calls := 0
+	err := QueryBatches(db, 3, func(users []struct{ ID int64 }) error {
+		calls++
+		return nil
+	}, "SELECT id, name, email FROM users;")
+	assert.EqualError(t, err, "query returned 3 columns, but only a single column can be scanned; use QueryStructs to scan whole rows")
+	assert.Zero(t, calls)
+}
+
+func TestQueryChan(t *testing.T) {
+	srv := newFakeServer(t, idsHandler(5))
+	db := &DB{db: srv.open(t)}
+
+	values, errs := QueryChan[int64](context.Background(), db, "SELECT id FROM users;")
+	var ids []int64
+	for id := range values {
+		ids = append(ids, id)
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+}
+
+func TestQueryChanMultipleColumns(t *testing.T) {
+	srv := newFakeServer(t, usersHandler)
+	db := &DB{db: srv.open(t)}
+
+	values, errs := QueryChan[struct{ ID int64 }](context.Background(), db, "SELECT id, name, email FROM users;")
+	_, ok := <-values
+	assert.False(t, ok)
+	assert.EqualError(t, <-errs, "query returned 3 columns, but only a single column can be scanned; use QueryStructs to scan whole rows")
+}
+
+func TestQueryChanCancelled(t *testing.T) {
+	srv := newFakeServer(t, idsHandler(5))
+	db := &DB{db: srv.open(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	values, errs := QueryChan[int64](ctx, db, "SELECT id FROM users;")
+	assert.Equal(t, int64(1), <-values)
+	assert.Equal(t, int64(2), <-values)
+	cancel()
+
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	_, ok := <-values
+	assert.False(t, ok)
+	assert.Equal(t, 0, db.sqlDB().Stats().InUse, "rows are closed")
+}
@@ -0,0 +1,326 @@
+package mysqldb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bookkeepingTables are the tables managed by the DB itself, which are
+// excluded from schema introspection.
+var bookkeepingTables = map[string]bool{
+	"__Migrations":          true,
+	"__MigrationStatements": true,
+	"__MigrationLock":       true,
+}
+
+// userTables returns the names of the base tables in the database,
+// excluding the DB's bookkeeping tables, sorted by name.
+func (db *DB) userTables() ([]string, error) {
+	rows, err := db.Query(`
+SELECT TABLE_NAME
+FROM information_schema.TABLES
+WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'
+ORDER BY TABLE_NAME;`, db.database())
+	if err != nil {
+		return nil, fmt.Errorf("querying tables: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("scanning table: %w", err)
+		}
+		if bookkeepingTables[table] {
+			continue
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rowsErr(rows)
+}
+
+// rowsErr returns the error, if any, encountered during iteration of rows.
+func rowsErr(rows Rows) error {
+	if r, ok := rows.(interface{ Err() error }); ok {
+		return r.Err()
+	}
+	return nil
+}
+
+// DumpSchema returns the CREATE TABLE statements for every table in the
+// database, as reported by SHOW CREATE TABLE. The migrations table is
+// excluded. The statements are wrapped in SET FOREIGN_KEY_CHECKS, so a
+// table can reference one created after it. The result can be applied
+// to another database with LoadSchema.
+func (db *DB) DumpSchema() (string, error) {
+	ddl, err := db.createTables()
+	if err != nil {
+		return "", err
+	}
+	return "SET FOREIGN_KEY_CHECKS = 0;\n\n" + ddl + "\nSET FOREIGN_KEY_CHECKS = 1;\n", nil
+}
+
+// createTables returns the CREATE TABLE statement for every table in the
+// database other than the DB's bookkeeping tables, separated by blank
+// lines.
+func (db *DB) createTables() (string, error) {
+	tables, err := db.userTables()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, table := range tables {
+		quoted, err := db.qualifyTable(table)
+		if err != nil {
+			return "", err
+		}
+
+		var name, ddl string
+		row := db.QueryRow("SHOW CREATE TABLE " + quoted + ";")
+		if err = row.Scan(&name, &ddl); err != nil {
+			return "", fmt.Errorf("showing create table %s: %w", table, err)
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(ddl)
+		b.WriteString(";\n")
+	}
+
+	return b.String(), nil
+}
+
+// autoIncrementOption matches the AUTO_INCREMENT table option in the
+// output of SHOW CREATE TABLE, which changes as rows are inserted.
+var autoIncrementOption = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// SchemaFingerprint returns a hex encoded SHA-256 hash of the schema's
+// CREATE TABLE statements, as returned by DumpSchema, so unintended
+// schema changes can be detected e.g. in CI. AUTO_INCREMENT counters are
+// removed before hashing, so the fingerprint only changes when the
+// schema itself does.
+func (db *DB) SchemaFingerprint() (string, error) {
+	ddl, err := db.createTables()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(autoIncrementOption.ReplaceAllString(ddl, "")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LoadSchema executes each statement of ddl, such as the output of
+// DumpSchema or DumpData. The statements are split in the same way as
+// migrations, so delimiter changes are supported. They're run on the
+// session connection with foreign key checks disabled, so tables and
+// rows can reference ones loaded after them.
+func (db *DB) LoadSchema(ddl string) error {
+	err := db.WithoutForeignKeyChecks(func(c Conn) error {
+		return execScript(c, ddl)
+	})
+	if err != nil {
+		return fmt.Errorf("loading schema: %w", err)
+	}
+	return nil
+}
+
+// ResetAutoIncrement sets the next AUTO_INCREMENT value of table, which
+// gives predictable IDs in test fixtures, e.g. after truncating a table.
+func (db *DB) ResetAutoIncrement(table string, value int64) error {
+	quoted, err := db.qualifyTable(table)
+	if err != nil {
+		return err
+	}
+
+	// DDL doesn't support placeholders, so the value is formatted in
+	if _, err = db.Exec("ALTER TABLE " + quoted + " AUTO_INCREMENT = " + strconv.FormatInt(value, 10) + ";"); err != nil {
+		return fmt.Errorf("resetting auto increment: %w", err)
+	}
+	return nil
+}
+
+// ForeignKey describes a column of a foreign key constraint. A constraint
+// spanning several columns is described by one ForeignKey per column.
+type ForeignKey struct {
+	Name             string
+	Column           string
+	ReferencedTable  string
+	ReferencedColumn string
+}
+
+// ForeignKeys returns the foreign keys defined on table, ordered by
+// constraint name and then column position.
+func (db *DB) ForeignKeys(table string) ([]ForeignKey, error) {
+	rows, err := db.Query(`
+SELECT CONSTRAINT_NAME, COLUMN_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+FROM information_schema.KEY_COLUMN_USAGE
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND REFERENCED_TABLE_NAME IS NOT NULL
+ORDER BY CONSTRAINT_NAME, ORDINAL_POSITION;`, db.database(), table)
+	if err != nil {
+		return nil, fmt.Errorf("querying foreign keys: %w", err)
+	}
+	defer rows.Close()
+
+	fks := make([]ForeignKey, 0)
+	for rows.Next() {
+		var fk ForeignKey
+		if err = rows.Scan(&fk.Name, &fk.Column, &fk.ReferencedTable, &fk.ReferencedColumn); err != nil {
+			return nil, fmt.Errorf("scanning foreign key: %w", err)
+		}
+		fks = append(fks, fk)
+	}
+
+	return fks, rowsErr(rows)
+}
+
+// Index describes an index on a table. Columns are in index order, and
+// the column of a functional key part is empty.
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Type    string
+}
+
+// Indexes returns the indexes defined on table, ordered by name.
+func (db *DB) Indexes(table string) ([]Index, error) {
+	rows, err := db.Query(`
+SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE, INDEX_TYPE
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+ORDER BY INDEX_NAME, SEQ_IN_INDEX;`, db.database(), table)
+	if err != nil {
+		return nil, fmt.Errorf("querying indexes: %w", err)
+	}
+	defer rows.Close()
+
+	indexes := make([]Index, 0)
+	for rows.Next() {
+		var (
+			name, indexType string
+			column          sql.NullString
+			nonUnique       int
+		)
+		if err = rows.Scan(&name, &column, &nonUnique, &indexType); err != nil {
+			return nil, fmt.Errorf("scanning index: %w", err)
+		}
+
+		if n := len(indexes); n == 0 || indexes[n-1].Name != name {
+			indexes = append(indexes, Index{Name: name, Unique: nonUnique == 0, Type: indexType})
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column.String)
+	}
+
+	return indexes, rowsErr(rows)
+}
+
+// TableExists reports whether table exists in the database.
+func (db *DB) TableExists(table string) (bool, error) {
+	var exists Bool
+	row := db.QueryRow("SELECT COALESCE((SELECT b'1' FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?), b'0');", db.database(), table)
+	if err := row.Scan(&exists); err != nil {
+		return false, fmt.Errorf("querying for table: %w", err)
+	}
+	return bool(exists), nil
+}
+
+// WaitForTable polls every interval until table exists, such as when it's
+// created by another service starting alongside this one. It returns the
+// context's error if ctx is done first, and an error if interval isn't
+// positive.
+func (db *DB) WaitForTable(ctx context.Context, table string, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		exists, err := db.TableExists(table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Optimize runs OPTIMIZE TABLE on each of the given tables, or on every
+// table other than the DB's bookkeeping tables if none are given. Every
+// table is optimized even if some fail, and the failures are returned
+// together. A failure is either an error running the statement or an
+// error reported in its result.
+func (db *DB) Optimize(tables ...string) error {
+	if len(tables) == 0 {
+		var err error
+		if tables, err = db.userTables(); err != nil {
+			return err
+		}
+	}
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		q, err := db.qualifyTable(table)
+		if err != nil {
+			return err
+		}
+		quoted[i] = q
+	}
+
+	var errs errorList
+	for i, table := range tables {
+		if err := db.optimizeTable(quoted[i]); err != nil {
+			errs = append(errs, fmt.Errorf("optimizing table %s: %w", table, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// optimizeTable runs OPTIMIZE TABLE on the quoted table, returning the
+// first error reported in its result.
+func (db *DB) optimizeTable(quoted string) error {
+	rows, err := db.Query("OPTIMIZE TABLE " + quoted + ";")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var failure error
+	for rows.Next() {
+		var table, op, msgType, msgText string
+		if err = rows.Scan(&table, &op, &msgType, &msgText); err != nil {
+			return fmt.Errorf("scanning result: %w", err)
+		}
+		if failure == nil && strings.EqualFold(msgType, "error") {
+			failure = errors.New(msgText)
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return err
+	}
+	return failure
+}
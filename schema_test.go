@@ -0,0 +1,335 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUsersDDL = "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+	testPostsDDL = "CREATE TABLE `posts` (\n  `id` int NOT NULL,\n  `user_id` int NOT NULL\n)"
+)
+
+// schemaHandler answers table introspection queries for a schema made
+// up of the given tables and their DDL.
+func schemaHandler(tables map[string]string) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.Contains(q.query, "information_schema.TABLES"):
+			res := fakeResult{columns: []string{"TABLE_NAME"}}
+			for _, name := range []string{"__Migrations", "posts", "users"} {
+				if _, ok := tables[name]; ok {
+					res.rows = append(res.rows, []driver.Value{name})
+				}
+			}
+			return res, nil
+		case strings.HasPrefix(q.query, "SHOW CREATE TABLE"):
+			name := strings.Trim(strings.TrimSuffix(strings.TrimPrefix(q.query, "SHOW CREATE TABLE "), ";"), "`")
+			return fakeResult{
+				columns: []string{"Table", "Create Table"},
+				rows:    [][]driver.Value{{name, tables[name]}},
+			}, nil
+		}
+		return fakeResult{}, nil
+	}
+}
+
+func TestDumpAndLoadSchema(t *testing.T) {
+	src := newFakeServer(t, schemaHandler(map[string]string{
+		"__Migrations": "CREATE TABLE `__Migrations` (`ID` int)",
+		"posts":        testPostsDDL,
+		"users":        testUsersDDL,
+	}))
+	db := &DB{db: src.open(t), name: "test"}
+
+	ddl, err := db.DumpSchema()
+	require.NoError(t, err)
+	assert.Equal(t, "SET FOREIGN_KEY_CHECKS = 0;\n\n"+testPostsDDL+";\n\n"+testUsersDDL+";\n\nSET FOREIGN_KEY_CHECKS = 1;\n", ddl)
+	assert.NotContains(t, ddl, "__Migrations")
+
+	dst := newFakeServer(t, nil)
+	fresh := &DB{db: dst.open(t), name: "fresh"}
+	require.NoError(t, fresh.LoadSchema(ddl))
+	assert.Equal(t, []string{
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		testPostsDDL + ";",
+		testUsersDDL + ";",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+	}, dst.queries())
+}
+
+// A table can reference one that sorts after it, and its DDL can contain
+// the delimiter, or a delimiter change, inside quoted strings.
+func TestDumpAndLoadSchemaQuotedDelimiters(t *testing.T) {
+	posts := "CREATE TABLE `posts` (\n" +
+		"  `id` int NOT NULL,\n" +
+		"  `user_id` int NOT NULL,\n" +
+		"  `status` varchar(16) NOT NULL DEFAULT 'a;b',\n" +
+		"  CONSTRAINT `posts_user` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`)\n" +
+		") COMMENT='it''s \"a;\n" +
+		"delimiter //\n" +
+		"test\\';'"
+	src := newFakeServer(t, schemaHandler(map[string]string{"posts": posts, "users": testUsersDDL}))
+	db := &DB{db: src.open(t), name: "test"}
+
+	ddl, err := db.DumpSchema()
+	require.NoError(t, err)
+
+	dst := newFakeServer(t, nil)
+	fresh := &DB{db: dst.open(t), name: "fresh"}
+	require.NoError(t, fresh.LoadSchema(ddl))
+	assert.Equal(t, []string{
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		posts + ";",
+		testUsersDDL + ";",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+	}, dst.queries())
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	tables := map[string]string{
+		"__Migrations": "CREATE TABLE `__Migrations` (`ID` int) AUTO_INCREMENT=3",
+		"posts":        testPostsDDL,
+		"users":        testUsersDDL + " ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8mb4",
+	}
+	srv := newFakeServer(t, schemaHandler(tables))
+	db := &DB{db: srv.open(t), name: "test"}
+
+	fingerprint, err := db.SchemaFingerprint()
+	require.NoError(t, err)
+	assert.Len(t, fingerprint, 64)
+
+	again, err := db.SchemaFingerprint()
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, again, "stable across runs")
+
+	tables["users"] = testUsersDDL + " ENGINE=InnoDB AUTO_INCREMENT=1042 DEFAULT CHARSET=utf8mb4"
+	tables["__Migrations"] = "CREATE TABLE `__Migrations` (`ID` int, `Checksum` char(64))"
+	again, err = db.SchemaFingerprint()
+	require.NoError(t, err)
+	assert.Equal(t, fingerprint, again, "unaffected by counters and bookkeeping tables")
+
+	tables["posts"] = "CREATE TABLE `posts` (\n  `id` int NOT NULL,\n  `user_id` int NOT NULL,\n  `title` text\n)"
+	changed, err := db.SchemaFingerprint()
+	require.NoError(t, err)
+	assert.NotEqual(t, fingerprint, changed, "changes when a column is added")
+}
+
+func TestResetAutoIncrement(t *testing.T) {
+	var nextID int64 = 1
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(q.query, "INSERT"):
+			id := nextID
+			nextID++
+			return fakeResult{affected: 1, insertID: id}, nil
+		case strings.HasPrefix(q.query, "ALTER TABLE `users` AUTO_INCREMENT = "):
+			n, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(q.query, "ALTER TABLE `users` AUTO_INCREMENT = "), ";"), 10, 64)
+			nextID = n
+			return fakeResult{}, err
+		}
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	insert := func() int64 {
+		res, err := db.Exec("INSERT INTO users (name) VALUES (?);", "gavin")
+		require.NoError(t, err)
+		id, err := res.LastInsertId()
+		require.NoError(t, err)
+		return id
+	}
+
+	insert()
+	assert.EqualValues(t, 2, insert())
+
+	_, err := db.Exec("TRUNCATE TABLE users;")
+	require.NoError(t, err)
+	require.NoError(t, db.ResetAutoIncrement("users", 1))
+	assert.EqualValues(t, 1, insert())
+	assert.Contains(t, srv.queries(), "ALTER TABLE `users` AUTO_INCREMENT = 1;")
+}
+
+func TestForeignKeys(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if !strings.Contains(q.query, "information_schema.KEY_COLUMN_USAGE") || q.args[0] != "test" || q.args[1] != "posts" {
+			return fakeResult{}, nil
+		}
+		return fakeResult{
+			columns: []string{"CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME"},
+			rows:    [][]driver.Value{{[]byte("fk_posts_users"), []byte("user_id"), []byte("users"), []byte("id")}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+
+	fks, err := db.ForeignKeys("posts")
+	require.NoError(t, err)
+	assert.Equal(t, []ForeignKey{{
+		Name:             "fk_posts_users",
+		Column:           "user_id",
+		ReferencedTable:  "users",
+		ReferencedColumn: "id",
+	}}, fks)
+
+	fks, err = db.ForeignKeys("users")
+	require.NoError(t, err)
+	assert.Empty(t, fks)
+}
+
+func TestIndexes(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if !strings.Contains(q.query, "information_schema.STATISTICS") || q.args[0] != "test" || q.args[1] != "posts" {
+			return fakeResult{}, nil
+		}
+		return fakeResult{
+			columns: []string{"INDEX_NAME", "COLUMN_NAME", "NON_UNIQUE", "INDEX_TYPE"},
+			rows: [][]driver.Value{
+				{[]byte("PRIMARY"), []byte("id"), int64(0), []byte("BTREE")},
+				{[]byte("idx_title"), []byte("title"), int64(1), []byte("FULLTEXT")},
+				{[]byte("uniq_user_slug"), []byte("user_id"), int64(0), []byte("BTREE")},
+				{[]byte("uniq_user_slug"), []byte("slug"), int64(0), []byte("BTREE")},
+			},
+		}, nil
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+
+	indexes, err := db.Indexes("posts")
+	require.NoError(t, err)
+	assert.Equal(t, []Index{
+		{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Type: "BTREE"},
+		{Name: "idx_title", Columns: []string{"title"}, Type: "FULLTEXT"},
+		{Name: "uniq_user_slug", Columns: []string{"user_id", "slug"}, Unique: true, Type: "BTREE"},
+	}, indexes)
+
+	indexes, err = db.Indexes("users")
+	require.NoError(t, err)
+	assert.Empty(t, indexes)
+}
+
+// tableAppearsHandler reports a table as missing for the first polls
+// lookups and then as existing. The returned func counts the lookups.
+func tableAppearsHandler(polls int) (func(q fakeQuery) (fakeResult, error), func() int) {
+	var mu sync.Mutex
+	lookups := 0
+
+	handler := func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		return bitResult(lookups > polls), nil
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return lookups
+	}
+	return handler, count
+}
+
+func TestTableExists(t *testing.T) {
+	handler, _ := tableAppearsHandler(1)
+	srv := newFakeServer(t, handler)
+	db := &DB{db: srv.open(t), name: "test"}
+
+	exists, err := db.TableExists("shared")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	exists, err = db.TableExists("shared")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestWaitForTable(t *testing.T) {
+	handler, lookups := tableAppearsHandler(2)
+	srv := newFakeServer(t, handler)
+	db := &DB{db: srv.open(t), name: "test"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, db.WaitForTable(ctx, "shared", time.Millisecond))
+	assert.Equal(t, 3, lookups())
+}
+
+func TestWaitForTableTimeout(t *testing.T) {
+	handler, _ := tableAppearsHandler(1000000)
+	srv := newFakeServer(t, handler)
+	db := &DB{db: srv.open(t), name: "test"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, db.WaitForTable(ctx, "shared", time.Millisecond), context.DeadlineExceeded)
+}
+
+func TestWaitForTableInvalidInterval(t *testing.T) {
+	handler, lookups := tableAppearsHandler(1)
+	srv := newFakeServer(t, handler)
+	db := &DB{db: srv.open(t), name: "test"}
+
+	assert.Error(t, db.WaitForTable(context.Background(), "shared", 0))
+	assert.Error(t, db.WaitForTable(context.Background(), "shared", -time.Second))
+	assert.Zero(t, lookups())
+}
+
+func TestOptimize(t *testing.T) {
+	tables := schemaHandler(map[string]string{"__Migrations": "", "posts": "", "users": ""})
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if !strings.HasPrefix(q.query, "OPTIMIZE TABLE") {
+			return tables(q)
+		}
+		status := fakeResult{columns: []string{"Table", "Op", "Msg_type", "Msg_text"}}
+		status.rows = [][]driver.Value{{"test.posts", "optimize", "status", "OK"}}
+		return status, nil
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+
+	require.NoError(t, db.Optimize())
+	assert.Equal(t, []string{"OPTIMIZE TABLE `posts`;", "OPTIMIZE TABLE `users`;"}, srv.queries()[1:])
+
+	require.NoError(t, db.Optimize("users"))
+	assert.Equal(t, "OPTIMIZE TABLE `users`;", srv.queries()[3])
+
+	assert.Error(t, db.Optimize("posts", "users "))
+	assert.Len(t, srv.queries(), 4, "nothing runs with an invalid identifier")
+}
+
+func TestOptimizeErrors(t *testing.T) {
+	errLocked := errors.New("table is locked")
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch q.query {
+		case "OPTIMIZE TABLE `posts`;":
+			return fakeResult{}, errLocked
+		case "OPTIMIZE TABLE `users`;":
+			return fakeResult{
+				columns: []string{"Table", "Op", "Msg_type", "Msg_text"},
+				rows: [][]driver.Value{
+					{"test.users", "optimize", "Error", "Table 'test.users' doesn't exist"},
+					{"test.users", "optimize", "status", "Operation failed"},
+				},
+			}, nil
+		}
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t), name: "test"}
+
+	err := db.Optimize("posts", "tags", "users")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errLocked)
+	assert.Contains(t, err.Error(), "optimizing table posts: ")
+	assert.Contains(t, err.Error(), "optimizing table users: Table 'test.users' doesn't exist")
+	assert.NotContains(t, err.Error(), "tags")
+	assert.Len(t, srv.queries(), 3, "every table is optimized")
+}
@@ -0,0 +1,299 @@
+package mysqldb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// errUnexpectedEnd is returned by splitStatements when a script ends
+// with a statement that isn't terminated by the current delimiter.
+var errUnexpectedEnd = errors.New("unexpected end of script")
+
+// delimiterChange starts a line changing the delimiter of a script.
+const delimiterChange = "delimiter "
+
+// splitStatements splits a SQL script into statements and calls fn for
+// each one, in order, stopping at the first error. The script may change
+// its delimiter using a `delimiter` line, in the same way as the mysql
+// client. Delimiters and delimiter changes inside quotes, backticks and
+// comments are ignored. Statements include the delimiter only if it's a
+// semi-colon.
+func splitStatements(sql string, fn func(stmt string) error) error {
+	return splitStatementsReader(strings.NewReader(sql), fn)
+}
+
+// splitStatementsReader is splitStatements for a script read from r. The
+// script is read a line at a time, and fn is called as soon as each
+// statement has been read, so only the current statement is held in
+// memory.
+func splitStatementsReader(r io.Reader, fn func(stmt string) error) error {
+	s := &statementScanner{r: bufio.NewReader(r), delim: ";"}
+	for {
+		done, err := s.next(fn)
+		if done || err != nil {
+			return err
+		}
+	}
+}
+
+// statementScanner splits statements from a script as it's read.
+type statementScanner struct {
+	r     *bufio.Reader
+	eof   bool
+	delim string
+
+	// buf holds the script read but not yet split, without leading
+	// whitespace. It's been scanned up to pos without finding the end of
+	// a statement, and quoted is the quote or comment open at pos, if any.
+	buf    []byte
+	pos    int
+	quoted string
+}
+
+// next splits the next statement or delimiter change from the script,
+// reading more of it as needed. It reports true once the script is done.
+func (s *statementScanner) next(fn func(stmt string) error) (bool, error) {
+	for {
+		i, change := s.scan()
+		switch {
+		case i != -1 && !change:
+			var stmt string
+			// only include the delimiter if it's a semi-colon
+			if s.delim == ";" {
+				stmt = string(s.buf[:i+1])
+			} else {
+				stmt = string(s.buf[:i])
+			}
+
+			s.advance(i + len(s.delim))
+			return false, fn(stmt)
+		case i != -1:
+			lineEnd := bytes.IndexByte(s.buf[i:], '\n')
+			if lineEnd == -1 && !s.eof {
+				// the delimiter change may not have been fully read yet
+				break
+			}
+			if lineEnd == -1 {
+				lineEnd = len(s.buf) - i
+			}
+
+			// the mysql client sends an unterminated statement before a
+			// delimiter change as it is
+			if stmt := bytes.TrimRightFunc(s.buf[:i], unicode.IsSpace); len(stmt) > 0 {
+				if err := fn(string(stmt)); err != nil {
+					return false, err
+				}
+			}
+
+			delim := strings.TrimSpace(string(s.buf[i+len(delimiterChange) : i+lineEnd]))
+			if delim == "" {
+				return true, errors.New("delimiter change without a delimiter")
+			}
+			s.delim = delim
+
+			// advance the sql past the delimiter change statement since the client will
+			// only handle this correctly without it
+			s.advance(i + lineEnd)
+			return false, nil
+		case s.eof:
+			if len(s.buf) == 0 {
+				return true, nil
+			}
+			return true, errUnexpectedEnd
+		}
+
+		if err := s.read(); err != nil {
+			return true, err
+		}
+	}
+}
+
+// scan scans the buffer from pos for the end of a statement, skipping
+// quotes and comments. It returns the index of the delimiter, or of a
+// delimiter change at the start of a line and true. It returns -1 if
+// neither has been read yet, leaving pos where scanning can resume.
+func (s *statementScanner) scan() (int, bool) {
+	for ; s.pos < len(s.buf); s.pos++ {
+		rest := s.buf[s.pos:]
+
+		switch s.quoted {
+		case "'", `"`:
+			if rest[0] == '\\' {
+				if len(rest) == 1 {
+					return -1, false
+				}
+				s.pos++
+			} else if rest[0] == s.quoted[0] {
+				s.quoted = ""
+			}
+			continue
+		case "`":
+			if rest[0] == '`' {
+				s.quoted = ""
+			}
+			continue
+		case "--":
+			if rest[0] == '\n' {
+				s.quoted = ""
+			}
+			continue
+		case "/*":
+			if bytes.HasPrefix(rest, []byte("*/")) {
+				s.quoted = ""
+				s.pos++
+			} else if len(rest) == 1 && !s.eof {
+				return -1, false
+			}
+			continue
+		}
+
+		if s.pos == 0 || s.buf[s.pos-1] == '\n' {
+			if bytes.HasPrefix(rest, []byte(delimiterChange)) {
+				return s.pos, true
+			}
+			if s.partial(rest, delimiterChange) {
+				return -1, false
+			}
+		}
+		if bytes.HasPrefix(rest, []byte(s.delim)) {
+			return s.pos, false
+		}
+		if s.partial(rest, s.delim) {
+			return -1, false
+		}
+
+		switch rest[0] {
+		case '\'', '"', '`':
+			s.quoted = string(rest[0])
+		case '#':
+			s.quoted = "--"
+		case '-':
+			// a double dash only starts a comment if it's followed by
+			// whitespace or a control character
+			if len(rest) < 3 && !s.eof {
+				return -1, false
+			}
+			if len(rest) >= 3 && rest[1] == '-' && rest[2] <= ' ' {
+				s.quoted = "--"
+			}
+		case '/':
+			if len(rest) == 1 && !s.eof {
+				return -1, false
+			}
+			if len(rest) > 1 && rest[1] == '*' {
+				s.quoted = "/*"
+				s.pos++
+			}
+		}
+	}
+	return -1, false
+}
+
+// partial reports whether b may start with prefix once more of the
+// script has been read.
+func (s *statementScanner) partial(b []byte, prefix string) bool {
+	return !s.eof && len(b) < len(prefix) && strings.HasPrefix(prefix, string(b))
+}
+
+// advance discards the first n bytes of the buffer and the whitespace
+// that follows them. The rest is moved to the start of the buffer, so
+// the memory of statements already split can be reused.
+func (s *statementScanner) advance(n int) {
+	rest := bytes.TrimLeftFunc(s.buf[n:], unicode.IsSpace)
+	s.buf = append(s.buf[:0], rest...)
+	s.pos, s.quoted = 0, ""
+}
+
+// read appends the next line of the script to the buffer.
+func (s *statementScanner) read() error {
+	line, err := s.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		err = nil
+	}
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("reading script: %w", err)
+	}
+	s.eof = err == io.EOF
+
+	if len(s.buf) == 0 {
+		line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	}
+	s.buf = append(s.buf, line...)
+	if s.eof {
+		// trailing whitespace may hide a delimiter change at the end
+		s.buf = bytes.TrimRightFunc(s.buf, unicode.IsSpace)
+		if s.pos > len(s.buf) {
+			s.pos = len(s.buf)
+		}
+	}
+	return nil
+}
+
+// firstWord returns the first word of stmt after any leading whitespace
+// and comments, such as its verb, and the offset in stmt of its end.
+func firstWord(stmt string) (string, int) {
+	rest := stmt
+	for {
+		rest = strings.TrimLeft(rest, " \t\r\n")
+		switch {
+		case strings.HasPrefix(rest, "--"), strings.HasPrefix(rest, "#"):
+			_, rest, _ = strings.Cut(rest, "\n")
+		case strings.HasPrefix(rest, "/*"):
+			_, rest, _ = strings.Cut(rest[2:], "*/")
+		default:
+			end := strings.IndexFunc(rest, func(r rune) bool {
+				return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+			})
+			if end < 0 {
+				end = len(rest)
+			}
+			start := len(stmt) - len(rest)
+			return rest[:end], start + end
+		}
+	}
+}
+
+// execScript executes each statement of a SQL script against c.
+func execScript(c Conn, sql string) error {
+	return splitStatements(sql, func(stmt string) error {
+		_, err := c.Exec(stmt)
+		return err
+	})
+}
+
+// ExecScript executes each statement of a SQL script, split in the same
+// way as migrations, binding the i-th slice of argsPerStatement to the
+// i-th statement. A nil slice runs its statement without arguments, and
+// if no slices are given at all, none of the statements have arguments.
+// Otherwise, it's an error for the number of slices to differ from the
+// number of statements, and nothing is executed.
+func (db *DB) ExecScript(script string, argsPerStatement ...[]interface{}) error {
+	var statements []string
+	err := splitStatements(script, func(stmt string) error {
+		statements = append(statements, stmt)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("splitting script: %w", err)
+	}
+
+	if len(argsPerStatement) > 0 && len(argsPerStatement) != len(statements) {
+		return fmt.Errorf("script has %d statements, but %d sets of arguments were given", len(statements), len(argsPerStatement))
+	}
+
+	for i, stmt := range statements {
+		var args []interface{}
+		if len(argsPerStatement) > 0 {
+			args = argsPerStatement[i]
+		}
+		if _, err = db.Exec(stmt, args...); err != nil {
+			return fmt.Errorf("executing statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectStatements(t *testing.T, sql string) []string {
+	t.Helper()
+	var stmts []string
+	require.NoError(t, splitStatements(sql, func(stmt string) error {
+		stmts = append(stmts, stmt)
+		return nil
+	}))
+	return stmts
+}
+
+func TestSplitStatements(t *testing.T) {
+	stmts := collectStatements(t, `
+CREATE TABLE a (ID INT);
+INSERT INTO a VALUES (1);
+`)
+	assert.Equal(t, []string{"CREATE TABLE a (ID INT);", "INSERT INTO a VALUES (1);"}, stmts)
+}
+
+func TestSplitStatementsDelimiterChange(t *testing.T) {
+	stmts := collectStatements(t, `
+CREATE TABLE a (ID INT);
+delimiter $$
+CREATE PROCEDURE p() BEGIN SELECT 1; END$$
+CREATE PROCEDURE q() BEGIN SELECT 2; END$$
+delimiter ;
+INSERT INTO a VALUES (1);
+`)
+	assert.Equal(t, []string{
+		"CREATE TABLE a (ID INT);",
+		"CREATE PROCEDURE p() BEGIN SELECT 1; END",
+		"CREATE PROCEDURE q() BEGIN SELECT 2; END",
+		"INSERT INTO a VALUES (1);",
+	}, stmts)
+}
+
+// The whole of a multi-character delimiter is skipped after a statement.
+// The splitter originally inlined in runMigrations only skipped its first
+// character, leaving the rest at the start of the next statement.
+func TestSplitStatementsMultiCharacterDelimiter(t *testing.T) {
+	stmts := collectStatements(t, `
+delimiter $$
+CREATE PROCEDURE p() BEGIN SELECT 1; END$$
+delimiter ;
+delimiter ;;;
+CREATE PROCEDURE q() BEGIN SELECT 2; END;;;CREATE PROCEDURE r() BEGIN SELECT 3; END;;;
+delimiter ;
+INSERT INTO a VALUES (1);
+`)
+	assert.Equal(t, []string{
+		"CREATE PROCEDURE p() BEGIN SELECT 1; END",
+		"CREATE PROCEDURE q() BEGIN SELECT 2; END",
+		"CREATE PROCEDURE r() BEGIN SELECT 3; END",
+		"INSERT INTO a VALUES (1);",
+	}, stmts)
+}
+
+// Delimiters and delimiter changes are ignored inside quotes, backticks
+// and comments, and a delimiter change is only recognized at the start
+// of a line.
+func TestSplitStatementsQuoted(t *testing.T) {
+	stmts := collectStatements(t, `
+INSERT INTO a VALUES ('a;b', "c;d", 'it\'s;', 'it''s;', "\\");
+SELECT `+"`x;y`"+` FROM a; -- a comment; with a delimiter
+# another; comment
+SELECT 1 /* a; block
+delimiter //
+comment */ + 1;
+SELECT 'delimiter // ;
+delimiter //
+';
+SELECT 2 - -1, 3--1;
+`)
+	assert.Equal(t, []string{
+		`INSERT INTO a VALUES ('a;b', "c;d", 'it\'s;', 'it''s;', "\\");`,
+		"SELECT `x;y` FROM a;",
+		"-- a comment; with a delimiter\n# another; comment\nSELECT 1 /* a; block\ndelimiter //\ncomment */ + 1;",
+		"SELECT 'delimiter // ;\ndelimiter //\n';",
+		"SELECT 2 - -1, 3--1;",
+	}, stmts)
+}
+
+// The mysql client runs an unterminated statement before a delimiter
+// change, rather than treating the change as part of it.
+func TestSplitStatementsDelimiterChangeAfterUnterminated(t *testing.T) {
+	stmts := collectStatements(t, "SELECT 1\ndelimiter //\nSELECT 2//\n")
+	assert.Equal(t, []string{"SELECT 1", "SELECT 2"}, stmts)
+}
+
+func TestSplitStatementsUnterminatedQuote(t *testing.T) {
+	err := splitStatements("SELECT 'a;\n", func(string) error { return nil })
+	assert.ErrorIs(t, err, errUnexpectedEnd)
+}
+
+func TestSplitStatementsEmptyDelimiter(t *testing.T) {
+	err := splitStatements("delimiter \nSELECT 1;\n", func(string) error { return nil })
+	assert.EqualError(t, err, "delimiter change without a delimiter")
+}
+
+func TestSplitStatementsUnexpectedEnd(t *testing.T) {
+	err := splitStatements("CREATE TABLE a (ID INT);\nSELECT 1", func(string) error { return nil })
+	assert.ErrorIs(t, err, errUnexpectedEnd)
+}
+
+// scriptGenerator is a reader generating a script of n statements as it's
+// read, switching delimiter halfway through. It counts the bytes read.
+type scriptGenerator struct {
+	n, i int
+	buf  []byte
+	read int
+}
+
+func (g *scriptGenerator) Read(p []byte) (int, error) {
+	for len(g.buf) == 0 {
+		switch {
+		case g.i == g.n:
+			return 0, io.EOF
+		case g.i == g.n/2:
+			g.buf = []byte("delimiter $$\n")
+		}
+		if g.i < g.n/2 {
+			g.buf = append(g.buf, fmt.Sprintf("INSERT INTO a VALUES (%d);\n", g.i)...)
+		} else {
+			g.buf = append(g.buf, fmt.Sprintf("CREATE PROCEDURE p%d() BEGIN SELECT %d; END$$\n", g.i, g.i)...)
+		}
+		g.i++
+	}
+
+	n := copy(p, g.buf)
+	g.buf = g.buf[n:]
+	g.read += n
+	return n, nil
+}
+
+func TestSplitStatementsReaderStreams(t *testing.T) {
+	const n = 100000
+	g := &scriptGenerator{n: n}
+
+	i := 0
+	err := splitStatementsReader(g, func(stmt string) error {
+		want := fmt.Sprintf("INSERT INTO a VALUES (%d);", i)
+		if i >= n/2 {
+			want = fmt.Sprintf("CREATE PROCEDURE p%d() BEGIN SELECT %d; END", i, i)
+		}
+		require.Equal(t, want, stmt)
+
+		// statements are split as they're read, rather than once the
+		// whole multi-megabyte script has been read
+		require.Less(t, g.read, (i+1)*64+8192)
+		i++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, n, i)
+}
+
+func TestExecScript(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	script := `
+INSERT INTO users (id, name) VALUES (?, ?);
+delimiter //
+UPDATE users SET name = ? WHERE id = ?//
+`
+	require.NoError(t, db.ExecScript(script, []interface{}{1, "gavin"}, []interface{}{"wade", 1}))
+	assert.Equal(t, []string{
+		"INSERT INTO users (id, name) VALUES (?, ?);",
+		"UPDATE users SET name = ? WHERE id = ?",
+	}, srv.queries())
+}
+
+func TestExecScriptArgs(t *testing.T) {
+	var args [][]driver.Value
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		args = append(args, q.args)
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	script := "INSERT INTO users (id, name) VALUES (?, ?);\nDELETE FROM posts;\nDELETE FROM users WHERE id = ?;"
+	require.NoError(t, db.ExecScript(script, []interface{}{1, "gavin"}, nil, []interface{}{2}))
+	assert.Equal(t, [][]driver.Value{{int64(1), "gavin"}, {}, {int64(2)}}, args)
+
+	require.NoError(t, db.ExecScript("DELETE FROM posts;\nDELETE FROM users;"))
+	assert.Len(t, args, 5)
+}
+
+func TestExecScriptArgsMismatch(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	err := db.ExecScript("INSERT INTO a VALUES (?);\nINSERT INTO b VALUES (?);", []interface{}{1})
+	assert.ErrorContains(t, err, "script has 2 statements, but 1 sets of arguments were given")
+	assert.Empty(t, srv.queries(), "nothing is executed")
+}
@@ -0,0 +1,323 @@
+package mysqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+var (
+	// ErrNotReplica is returned by ReplicaLag when the server isn't a replica.
+	ErrNotReplica = errors.New("server is not a replica")
+	// ErrReplicationStopped is returned by ReplicaLag when the server is a
+	// replica but its lag is unknown because replication isn't running.
+	ErrReplicationStopped = errors.New("replication is stopped")
+	// ErrUnknownVariable is returned by ServerVariable when the server
+	// has no variable with the given name.
+	ErrUnknownVariable = errors.New("unknown server variable")
+)
+
+// ReplicaLag returns how far the server is behind its replication source.
+// ErrNotReplica is returned if the server isn't a replica, and
+// ErrReplicationStopped if replication isn't running.
+func (db *DB) ReplicaLag() (time.Duration, error) {
+	rows, err := db.Query("SHOW REPLICA STATUS;")
+	// servers before 8.0.22 only support the old syntax, and fail to
+	// parse the new one
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 {
+		rows, err = db.Query("SHOW SLAVE STATUS;")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("showing replica status: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rowsErr(rows); err != nil {
+			return 0, fmt.Errorf("showing replica status: %w", err)
+		}
+		return 0, ErrNotReplica
+	}
+
+	status, err := ScanRowToMap(rows)
+	if err != nil {
+		return 0, fmt.Errorf("scanning replica status: %w", err)
+	}
+
+	lag, ok := status["Seconds_Behind_Source"]
+	if !ok {
+		lag, ok = status["Seconds_Behind_Master"]
+	}
+	if !ok {
+		return 0, errors.New("replica status is missing the seconds behind source")
+	}
+
+	var seconds int64
+	switch v := lag.(type) {
+	case nil:
+		return 0, ErrReplicationStopped
+	case int64:
+		seconds = v
+	case uint64:
+		seconds = int64(v)
+	default:
+		if seconds, err = strconv.ParseInt(fmt.Sprint(v), 10, 64); err != nil {
+			return 0, fmt.Errorf("parsing seconds behind source: %w", err)
+		}
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// ServerVariable returns the value of the named system variable, as
+// reported by SHOW VARIABLES on the session connection. Session values
+// set with SetSessionVariable are returned in place of global ones.
+// ErrUnknownVariable is returned if the server has no such variable.
+func (db *DB) ServerVariable(name string) (string, error) {
+	if !isKeyword(name) {
+		return "", fmt.Errorf("invalid variable name %q", name)
+	}
+
+	conn, err := db.Session()
+	if err != nil {
+		return "", err
+	}
+
+	// SHOW can't be prepared, so the validated name is inlined with its
+	// underscores escaped to stop them matching any character.
+	var variable, value string
+	pattern := strings.ReplaceAll(name, "_", `\_`)
+	err = conn.QueryRow("SHOW VARIABLES LIKE '"+pattern+"';").Scan(&variable, &value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownVariable, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("showing variable %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// SetSessionVariable sets the named system variable for the session
+// connection, which is used by ServerVariable and Session. Statements
+// run on the DB itself use other connections from the pool and aren't
+// affected. Integer values are sent as integers, since MySQL rejects
+// strings for numeric variables.
+func (db *DB) SetSessionVariable(name, value string) error {
+	if !isKeyword(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+
+	conn, err := db.Session()
+	if err != nil {
+		return err
+	}
+
+	var arg interface{} = value
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		arg = n
+	}
+
+	if _, err = conn.Exec("SET SESSION "+name+" = ?;", arg); err != nil {
+		return fmt.Errorf("setting variable %s: %w", name, err)
+	}
+	return nil
+}
+
+// ProcessInfo describes a connection to the server, as reported by SHOW
+// FULL PROCESSLIST. NULL columns are left empty.
+type ProcessInfo struct {
+	ID      int64
+	User    string
+	Host    string
+	DB      string
+	Command string
+	// Time is how long the connection has been in its current state.
+	Time  time.Duration
+	State string
+	// Info is the statement being executed, if any.
+	Info string
+}
+
+// ProcessList returns the connections to the server visible to the DB's
+// user, as reported by SHOW FULL PROCESSLIST. It's useful for debugging
+// stuck queries. Columns are matched by name, so columns added by other
+// servers, such as MariaDB's Progress, are ignored.
+func (db *DB) ProcessList() ([]ProcessInfo, error) {
+	rows, err := db.Query("SHOW FULL PROCESSLIST;")
+	if err != nil {
+		return nil, fmt.Errorf("showing processlist: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		id, seconds                          sql.NullInt64
+		user, host, dbName, cmd, state, info sql.NullString
+	)
+	dest := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch strings.ToLower(column) {
+		case "id":
+			dest[i] = &id
+		case "user":
+			dest[i] = &user
+		case "host":
+			dest[i] = &host
+		case "db":
+			dest[i] = &dbName
+		case "command":
+			dest[i] = &cmd
+		case "time":
+			dest[i] = &seconds
+		case "state":
+			dest[i] = &state
+		case "info":
+			dest[i] = &info
+		default:
+			dest[i] = new(interface{})
+		}
+	}
+
+	processes := make([]ProcessInfo, 0)
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scanning process: %w", err)
+		}
+		processes = append(processes, ProcessInfo{
+			ID:      id.Int64,
+			User:    user.String,
+			Host:    host.String,
+			DB:      dbName.String,
+			Command: cmd.String,
+			Time:    time.Duration(seconds.Int64) * time.Second,
+			State:   state.String,
+			Info:    info.String,
+		})
+	}
+
+	return processes, rowsErr(rows)
+}
+
+// CurrentGrants returns the grants of the DB's user, one statement per
+// grant, as reported by SHOW GRANTS.
+func (db *DB) CurrentGrants() ([]string, error) {
+	rows, err := db.Query("SHOW GRANTS;")
+	if err != nil {
+		return nil, fmt.Errorf("showing grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make([]string, 0)
+	for rows.Next() {
+		var grant string
+		if err = rows.Scan(&grant); err != nil {
+			return nil, fmt.Errorf("scanning grant: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err = rowsErr(rows); err != nil {
+		return nil, fmt.Errorf("iterating grants: %w", err)
+	}
+	return grants, nil
+}
+
+// HasPrivilege reports whether the DB's user has the named privilege, such
+// as CREATE or "GRANT OPTION", on the whole server or on the DB's database,
+// according to CurrentGrants. ALL PRIVILEGES includes every privilege
+// other than GRANT OPTION. Privileges granted only on some tables or
+// columns, or through a wildcard database name or a role, aren't counted,
+// so it's suited to checking for those needed across the database, such
+// as to fail fast at startup.
+func (db *DB) HasPrivilege(priv string) (bool, error) {
+	grants, err := db.CurrentGrants()
+	if err != nil {
+		return false, err
+	}
+
+	priv = strings.ToUpper(strings.Join(strings.Fields(priv), " "))
+	for _, grant := range grants {
+		for _, p := range grantPrivileges(grant, db.database()) {
+			if p == priv || (p == "ALL PRIVILEGES" && priv != "GRANT OPTION") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// grantPrivileges returns the privileges a SHOW GRANTS statement such as
+// "GRANT SELECT, INSERT ON `app`.* TO `u`@`%`" grants on every database or
+// on database, in upper case. ALL is returned as ALL PRIVILEGES.
+func grantPrivileges(grant, database string) []string {
+	upper := strings.ToUpper(grant)
+	if !strings.HasPrefix(upper, "GRANT ") {
+		return nil
+	}
+	on := strings.Index(upper, " ON ")
+	to := strings.LastIndex(upper, " TO ")
+	if on == -1 || to < on {
+		return nil // a role grant, such as GRANT `r`@`%` TO `u`@`%`
+	}
+
+	object := strings.TrimSpace(grant[on+len(" ON ") : to])
+	if !strings.HasSuffix(object, ".*") {
+		return nil
+	}
+	if name := strings.TrimSuffix(object, ".*"); name != "*" && unquoteIdentifier(name) != database {
+		return nil
+	}
+
+	// split the list on the commas outside of column lists
+	var parts []string
+	list := upper[len("GRANT "):on]
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, list[start:])
+
+	privs := make([]string, 0, len(parts)+1)
+	for _, part := range parts {
+		p := strings.Join(strings.Fields(part), " ")
+		if strings.Contains(p, "(") {
+			continue // only granted on some columns
+		}
+		if p == "ALL" {
+			p = "ALL PRIVILEGES"
+		}
+		privs = append(privs, p)
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(upper), " WITH GRANT OPTION") {
+		privs = append(privs, "GRANT OPTION")
+	}
+	return privs
+}
+
+// unquoteIdentifier removes the backticks quoting an identifier, if any.
+func unquoteIdentifier(s string) string {
+	if len(s) >= 2 && s[0] == '`' && s[len(s)-1] == '`' {
+		return strings.ReplaceAll(s[1:len(s)-1], "``", "`")
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func replicaStatusHandler(column string, lag driver.Value, replica bool) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		if column == "Seconds_Behind_Master" && q.query == "SHOW REPLICA STATUS;" {
+			return fakeResult{}, &mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}
+		}
+		res := fakeResult{
+			columns: []string{"Replica_IO_State", column},
+			types:   []string{"VARCHAR", "BIGINT"},
+		}
+		if replica {
+			res.rows = [][]driver.Value{{[]byte("Waiting for source to send event"), lag}}
+		}
+		return res, nil
+	}
+}
+
+func TestReplicaLag(t *testing.T) {
+	srv := newFakeServer(t, replicaStatusHandler("Seconds_Behind_Source", []byte("12"), true))
+	db := &DB{db: srv.open(t)}
+
+	lag, err := db.ReplicaLag()
+	require.NoError(t, err)
+	assert.Equal(t, 12*time.Second, lag)
+}
+
+func TestReplicaLagLegacySyntax(t *testing.T) {
+	srv := newFakeServer(t, replicaStatusHandler("Seconds_Behind_Master", []byte("3"), true))
+	db := &DB{db: srv.open(t)}
+
+	lag, err := db.ReplicaLag()
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, lag)
+	assert.Equal(t, []string{"SHOW REPLICA STATUS;", "SHOW SLAVE STATUS;"}, srv.queries())
+}
+
+// Errors other than a syntax error, such as a missing privilege, are
+// returned rather than hidden by retrying with the old syntax.
+func TestReplicaLagError(t *testing.T) {
+	denied := &mysql.MySQLError{Number: 1227, Message: "Access denied; you need the REPLICATION CLIENT privilege"}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{}, denied
+	})
+	db := &DB{db: srv.open(t)}
+
+	_, err := db.ReplicaLag()
+	assert.ErrorIs(t, err, denied)
+	assert.Equal(t, []string{"SHOW REPLICA STATUS;"}, srv.queries())
+}
+
+func TestReplicaLagStopped(t *testing.T) {
+	srv := newFakeServer(t, replicaStatusHandler("Seconds_Behind_Source", nil, true))
+	db := &DB{db: srv.open(t)}
+
+	_, err := db.ReplicaLag()
+	assert.ErrorIs(t, err, ErrReplicationStopped)
+}
+
+func TestReplicaLagNotReplica(t *testing.T) {
+	srv := newFakeServer(t, replicaStatusHandler("Seconds_Behind_Source", nil, false))
+	db := &DB{db: srv.open(t)}
+
+	_, err := db.ReplicaLag()
+	assert.ErrorIs(t, err, ErrNotReplica)
+}
+
+// variablesHandler answers SHOW VARIABLES and SET SESSION with variables
+// that start with the given global values and can be overridden per
+// connection.
+func variablesHandler(globals map[string]string) func(q fakeQuery) (fakeResult, error) {
+	var mu sync.Mutex
+	sessions := map[int]map[string]string{}
+
+	return func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if strings.HasPrefix(q.query, "SET SESSION ") {
+			name := strings.TrimSuffix(strings.TrimPrefix(q.query, "SET SESSION "), " = ?;")
+			if sessions[q.conn] == nil {
+				sessions[q.conn] = map[string]string{}
+			}
+			sessions[q.conn][name] = fmt.Sprint(q.args[0])
+			return fakeResult{}, nil
+		}
+
+		name := strings.TrimSuffix(strings.TrimPrefix(q.query, "SHOW VARIABLES LIKE '"), "';")
+		name = strings.ReplaceAll(name, `\_`, "_")
+		res := fakeResult{columns: []string{"Variable_name", "Value"}}
+		if v, ok := sessions[q.conn][name]; ok {
+			res.rows = [][]driver.Value{{name, v}}
+		} else if v, ok := globals[name]; ok {
+			res.rows = [][]driver.Value{{name, v}}
+		}
+		return res, nil
+	}
+}
+
+func TestServerVariable(t *testing.T) {
+	srv := newFakeServer(t, variablesHandler(map[string]string{"max_connections": "151"}))
+	db := &DB{db: srv.open(t)}
+	defer db.Close()
+
+	v, err := db.ServerVariable("max_connections")
+	require.NoError(t, err)
+	assert.Equal(t, "151", v)
+	assert.Equal(t, []string{`SHOW VARIABLES LIKE 'max\_connections';`}, srv.queries())
+
+	_, err = db.ServerVariable("no_such_variable")
+	assert.ErrorIs(t, err, ErrUnknownVariable)
+
+	_, err = db.ServerVariable("max_connections'; DROP TABLE users; --")
+	assert.Error(t, err)
+}
+
+func TestSetSessionVariable(t *testing.T) {
+	srv := newFakeServer(t, variablesHandler(map[string]string{"max_execution_time": "0"}))
+	db := &DB{db: srv.open(t)}
+	defer db.Close()
+
+	require.NoError(t, db.SetSessionVariable("max_execution_time", "1000"))
+	v, err := db.ServerVariable("max_execution_time")
+	require.NoError(t, err)
+	assert.Equal(t, "1000", v)
+
+	assert.Error(t, db.SetSessionVariable("max_execution_time = 0, sql_mode", "''"))
+}
+
+func TestProcessList(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if q.query != "SHOW FULL PROCESSLIST;" {
+			return fakeResult{}, nil
+		}
+		return fakeResult{
+			columns: []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info", "Progress"},
+			rows: [][]driver.Value{
+				{int64(5), []byte("event_scheduler"), []byte("localhost"), nil, []byte("Daemon"), int64(3600), []byte("Waiting on empty queue"), nil, []byte("0.000")},
+				{int64(12), []byte("app"), []byte("10.0.0.7:52114"), []byte("app"), []byte("Query"), int64(42), []byte("Sending data"), []byte("SELECT * FROM posts"), []byte("0.000")},
+				{int64(13), []byte("app"), []byte("10.0.0.7:52116"), []byte("app"), []byte("Sleep"), int64(0), nil, nil, []byte("0.000")},
+			},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	processes, err := db.ProcessList()
+	require.NoError(t, err)
+	assert.Equal(t, []ProcessInfo{
+		{ID: 5, User: "event_scheduler", Host: "localhost", Command: "Daemon", Time: time.Hour, State: "Waiting on empty queue"},
+		{ID: 12, User: "app", Host: "10.0.0.7:52114", DB: "app", Command: "Query", Time: 42 * time.Second, State: "Sending data", Info: "SELECT * FROM posts"},
+		{ID: 13, User: "app", Host: "10.0.0.7:52116", DB: "app", Command: "Sleep"},
+	}, processes)
+}
+
+// grantsHandler answers SHOW GRANTS with grants.
+func grantsHandler(grants ...string) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		res := fakeResult{columns: []string{"Grants for app@%"}}
+		for _, grant := range grants {
+			res.rows = append(res.rows, []driver.Value{[]byte(grant)})
+		}
+		return res, nil
+	}
+}
+
+func TestCurrentGrants(t *testing.T) {
+	grants := []string{
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT SELECT, INSERT, UPDATE ON `app`.* TO `app`@`%`",
+	}
+	srv := newFakeServer(t, grantsHandler(grants...))
+	db := &DB{db: srv.open(t), name: "app"}
+
+	got, err := db.CurrentGrants()
+	require.NoError(t, err)
+	assert.Equal(t, grants, got)
+	assert.Equal(t, []string{"SHOW GRANTS;"}, srv.queries())
+}
+
+func TestHasPrivilege(t *testing.T) {
+	srv := newFakeServer(t, grantsHandler(
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT PROCESS, REPLICATION CLIENT ON *.* TO `app`@`%`",
+		"GRANT SELECT, INSERT, UPDATE (`name`, `email`), DELETE ON `app`.* TO `app`@`%`",
+		"GRANT ALTER ON `app`.`users` TO `app`@`%`",
+		"GRANT DROP ON `other`.* TO `app`@`%`",
+		"GRANT `admin`@`%` TO `app`@`%`",
+	))
+	db := &DB{db: srv.open(t), name: "app"}
+
+	for priv, want := range map[string]bool{
+		"SELECT":              true,
+		"insert":              true,
+		"DELETE":              true,
+		"PROCESS":             true,
+		"replication  client": true,
+		"UPDATE":              false, // only on some columns
+		"ALTER":               false, // only on one table
+		"DROP":                false, // only on another database
+		"CREATE":              false,
+		"GRANT OPTION":        false,
+	} {
+		has, err := db.HasPrivilege(priv)
+		require.NoError(t, err)
+		assert.Equal(t, want, has, priv)
+	}
+}
+
+func TestHasPrivilegeAll(t *testing.T) {
+	srv := newFakeServer(t, grantsHandler(
+		"GRANT USAGE ON *.* TO `app`@`%`",
+		"GRANT ALL PRIVILEGES ON `app`.* TO `app`@`%`",
+	))
+	db := &DB{db: srv.open(t), name: "app"}
+
+	has, err := db.HasPrivilege("CREATE")
+	require.NoError(t, err)
+	assert.True(t, has)
+	has, err = db.HasPrivilege("GRANT OPTION")
+	require.NoError(t, err)
+	assert.False(t, has, "not included in ALL PRIVILEGES")
+
+	srv = newFakeServer(t, grantsHandler("GRANT ALL ON *.* TO `root`@`localhost` WITH GRANT OPTION"))
+	db = &DB{db: srv.open(t), name: "app"}
+	has, err = db.HasPrivilege("GRANT OPTION")
+	require.NoError(t, err)
+	assert.True(t, has)
+}
@@ -0,0 +1,179 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// sessionConn returns the connection pinned for session state, such as
+// session variables, opening it on first use. Every call returns the
+// same connection until the DB is closed. A newly opened connection is
+// switched to the database selected with UseDatabase, if any.
+func (db *DB) sessionConn() (*sql.Conn, error) {
+	db.sessionMu.Lock()
+	defer db.sessionMu.Unlock()
+
+	if db.session == nil {
+		conn, err := db.sqlDB().Conn(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("opening session connection: %w", err)
+		}
+		if db.sessionDB != "" {
+			if err = useDatabase(conn, db.sessionDB); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		db.session = conn
+	}
+	return db.session, nil
+}
+
+// closeSession closes the pinned session connection, if it was opened,
+// and forgets the database selected with UseDatabase.
+func (db *DB) closeSession() error {
+	db.sessionMu.Lock()
+	defer db.sessionMu.Unlock()
+
+	db.sessionDB = ""
+	return db.dropSession()
+}
+
+// dropSession closes the pinned session connection, if it was opened, so
+// the next call to sessionConn opens a new one. sessionMu must be held.
+func (db *DB) dropSession() error {
+	if db.session == nil {
+		return nil
+	}
+	err := db.session.Close()
+	db.session = nil
+	if err != nil {
+		return fmt.Errorf("closing session connection: %w", err)
+	}
+	return nil
+}
+
+// database returns the name of the database introspection methods
+// target: the one selected with UseDatabase, or else the one from the
+// DSN.
+func (db *DB) database() string {
+	db.sessionMu.Lock()
+	defer db.sessionMu.Unlock()
+
+	if db.sessionDB != "" {
+		return db.sessionDB
+	}
+	return db.name
+}
+
+// qualifyTable returns table quoted, and qualified with the database
+// selected with UseDatabase, if it differs from the DSN's. Statements run
+// on the pool use the DSN's database, so the qualifier keeps them on the
+// same tables as introspection.
+func (db *DB) qualifyTable(table string) (string, error) {
+	quoted, err := QuoteIdentifier(table)
+	if err != nil {
+		return "", err
+	}
+
+	name := db.database()
+	if name == db.name {
+		return quoted, nil
+	}
+	quotedDB, err := QuoteIdentifier(name)
+	if err != nil {
+		return "", err
+	}
+	return quotedDB + "." + quoted, nil
+}
+
+// Session returns a Conn that runs every statement on a single pinned
+// connection rather than the pool, so it sees the state set by
+// SetSessionVariable. The connection is shared by every caller of
+// Session, so Rows returned by Query must be closed before running
+// another statement.
+func (db *DB) Session() (Conn, error) {
+	conn, err := db.sessionConn()
+	if err != nil {
+		return nil, err
+	}
+	return &ctxConn{
+		q: func() (queryerContext, func()) { return conn, func() {} },
+		newContext: func() (context.Context, context.CancelFunc) {
+			return context.Background(), func() {}
+		},
+	}, nil
+}
+
+// UseDatabase switches the session connection to the named database, so
+// introspection methods such as TableExists and DumpSchema target it from
+// then on. Only the session connection runs USE; the rest of the pool
+// stays on the database from the DSN, so statements that rely on the
+// default database should be run through Session. Name, and the options
+// that create and drop the database, such as DropDBOnClose, keep using
+// the DSN's database. Recreate switches back to it.
+func (db *DB) UseDatabase(name string) error {
+	if _, err := QuoteIdentifier(name); err != nil {
+		return err
+	}
+
+	conn, err := db.sessionConn()
+	if err != nil {
+		return err
+	}
+
+	db.sessionMu.Lock()
+	defer db.sessionMu.Unlock()
+
+	if db.session != conn {
+		return errors.New("session connection was closed while switching database")
+	}
+	if err = useDatabase(conn, name); err != nil {
+		return err
+	}
+	db.sessionDB = name
+	return nil
+}
+
+// useDatabase runs USE for the named database on conn.
+func useDatabase(conn *sql.Conn, name string) error {
+	quoted, err := QuoteIdentifier(name)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.ExecContext(context.Background(), "USE "+quoted+";"); err != nil {
+		return fmt.Errorf("using database: %w", err)
+	}
+	return nil
+}
+
+// WithoutForeignKeyChecks runs fn on the session connection with foreign
+// key checks disabled, such as for bulk loads that insert rows out of
+// order. Checks are enabled again once fn returns, even if it fails, and
+// are never disabled for the rest of the pool.
+func (db *DB) WithoutForeignKeyChecks(fn func(Conn) error) error {
+	conn, err := db.Session()
+	if err != nil {
+		return err
+	}
+	return withoutForeignKeyChecks(conn, fn)
+}
+
+// withoutForeignKeyChecks runs fn on c with foreign key checks disabled.
+// c must run every statement on the same connection.
+func withoutForeignKeyChecks(c Conn, fn func(Conn) error) error {
+	if _, err := c.Exec("SET FOREIGN_KEY_CHECKS = 0;"); err != nil {
+		return fmt.Errorf("disabling foreign key checks: %w", err)
+	}
+
+	err := fn(c)
+	if _, rerr := c.Exec("SET FOREIGN_KEY_CHECKS = 1;"); rerr != nil {
+		if err != nil {
+			return fmt.Errorf("enabling foreign key checks after %v: %w", err, rerr)
+		}
+		return fmt.Errorf("enabling foreign key checks: %w", rerr)
+	}
+	return err
+}
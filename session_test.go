@@ -0,0 +1,219 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	var conns []int
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		conns = append(conns, q.conn)
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	first, err := db.Session()
+	require.NoError(t, err)
+	second, err := db.Session()
+	require.NoError(t, err)
+
+	for _, c := range []Conn{first, second, db} {
+		_, err = c.Exec("SET @a = 1;")
+		require.NoError(t, err)
+	}
+	require.Len(t, conns, 3)
+	assert.Equal(t, conns[0], conns[1], "sessions share a connection")
+	assert.NotEqual(t, conns[0], conns[2], "the pool doesn't use the session connection")
+
+	require.NoError(t, db.Close())
+	assert.Nil(t, db.session)
+}
+
+func TestUseDatabase(t *testing.T) {
+	var (
+		useConn, selectConn int
+		schemas             []interface{}
+	)
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(q.query, "USE "):
+			useConn = q.conn
+		case q.query == "SELECT 1;":
+			selectConn = q.conn
+		case strings.Contains(q.query, "information_schema.TABLES"):
+			schemas = append(schemas, q.args[0])
+			return bitResult(true), nil
+		}
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t), name: "app"}
+	defer db.Close()
+
+	_, err := db.TableExists("users")
+	require.NoError(t, err)
+
+	require.NoError(t, db.UseDatabase("reporting"))
+	assert.Equal(t, "app", db.Name(), "the DSN's database is kept")
+	_, err = db.TableExists("users")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"app", "reporting"}, schemas)
+
+	session, err := db.Session()
+	require.NoError(t, err)
+	_, err = session.Exec("SELECT 1;")
+	require.NoError(t, err)
+	assert.Contains(t, srv.queries(), "USE `reporting`;")
+	assert.Equal(t, useConn, selectConn, "USE runs on the session connection")
+
+	assert.Error(t, db.UseDatabase("reporting "))
+	assert.Equal(t, "reporting", db.database())
+
+	require.NoError(t, db.closeSession())
+	assert.Equal(t, "app", db.database(), "closing the session switches back")
+}
+
+func TestUseDatabaseDumpSchema(t *testing.T) {
+	var schemas []interface{}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.Contains(q.query, "information_schema.TABLES"):
+			schemas = append(schemas, q.args[0])
+			return fakeResult{columns: []string{"TABLE_NAME"}, rows: [][]driver.Value{{"users"}}}, nil
+		case strings.HasPrefix(q.query, "SHOW CREATE TABLE"):
+			return fakeResult{
+				columns: []string{"Table", "Create Table"},
+				rows:    [][]driver.Value{{"users", testUsersDDL}},
+			}, nil
+		}
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t), name: "app"}
+	defer db.Close()
+
+	_, err := db.DumpSchema()
+	require.NoError(t, err)
+	assert.Contains(t, srv.queries(), "SHOW CREATE TABLE `users`;")
+
+	require.NoError(t, db.UseDatabase("reporting"))
+	ddl, err := db.DumpSchema()
+	require.NoError(t, err)
+	assert.Equal(t, "SET FOREIGN_KEY_CHECKS = 0;\n\n"+testUsersDDL+";\n\nSET FOREIGN_KEY_CHECKS = 1;\n", ddl)
+	assert.Equal(t, []interface{}{"app", "reporting"}, schemas)
+	assert.Contains(t, srv.queries(), "SHOW CREATE TABLE `reporting`.`users`;", "the pool is still on app")
+
+	require.NoError(t, db.ResetAutoIncrement("users", 1))
+	assert.Contains(t, srv.queries(), "ALTER TABLE `reporting`.`users` AUTO_INCREMENT = 1;")
+}
+
+func TestUseDatabaseDropOnClose(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db, err := NewDB(srv.dsn("app"), withFakeDriver(), DropDBOnClose())
+	require.NoError(t, err)
+
+	require.NoError(t, db.UseDatabase("reporting"))
+	require.NoError(t, db.Close())
+
+	queries := srv.queries()
+	assert.Contains(t, queries, "DROP DATABASE IF EXISTS `app`;")
+	assert.NotContains(t, queries, "DROP DATABASE IF EXISTS `reporting`;")
+}
+
+func TestUseDatabaseConcurrentIntrospection(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return bitResult(true), nil
+	})
+	db := &DB{db: srv.open(t), name: "app"}
+	defer db.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			_, err := db.TableExists("users")
+			assert.NoError(t, err)
+		}
+	}()
+	for _, name := range []string{"reporting", "archive", "app"} {
+		require.NoError(t, db.UseDatabase(name))
+	}
+	wg.Wait()
+}
+
+// foreignKeyHandler simulates a posts table whose user_id must reference
+// an existing user while foreign key checks are enabled on a connection.
+func foreignKeyHandler() func(q fakeQuery) (fakeResult, error) {
+	var mu sync.Mutex
+	disabled := map[int]bool{}
+
+	return func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch q.query {
+		case "SET FOREIGN_KEY_CHECKS = 0;":
+			disabled[q.conn] = true
+		case "SET FOREIGN_KEY_CHECKS = 1;":
+			delete(disabled, q.conn)
+		case "INSERT INTO posts (user_id) VALUES (?);":
+			if !disabled[q.conn] {
+				return fakeResult{}, &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails"}
+			}
+			return fakeResult{affected: 1}, nil
+		case "SELECT @@FOREIGN_KEY_CHECKS;":
+			checks := int64(1)
+			if disabled[q.conn] {
+				checks = 0
+			}
+			return fakeResult{columns: []string{"checks"}, rows: [][]driver.Value{{checks}}}, nil
+		}
+		return fakeResult{}, nil
+	}
+}
+
+func TestWithoutForeignKeyChecks(t *testing.T) {
+	srv := newFakeServer(t, foreignKeyHandler())
+	db := &DB{db: srv.open(t)}
+	defer db.Close()
+
+	err := db.WithoutForeignKeyChecks(func(c Conn) error {
+		_, err := c.Exec("INSERT INTO posts (user_id) VALUES (?);", 404)
+		return err
+	})
+	require.NoError(t, err)
+
+	session, err := db.Session()
+	require.NoError(t, err)
+	var checks int
+	require.NoError(t, session.QueryRow("SELECT @@FOREIGN_KEY_CHECKS;").Scan(&checks))
+	assert.Equal(t, 1, checks)
+
+	_, err = session.Exec("INSERT INTO posts (user_id) VALUES (?);", 404)
+	assert.Error(t, err)
+}
+
+func TestWithoutForeignKeyChecksError(t *testing.T) {
+	srv := newFakeServer(t, foreignKeyHandler())
+	db := &DB{db: srv.open(t)}
+	defer db.Close()
+
+	errLoad := errors.New("load failed")
+	err := db.WithoutForeignKeyChecks(func(c Conn) error {
+		return errLoad
+	})
+	assert.ErrorIs(t, err, errLoad)
+
+	session, err := db.Session()
+	require.NoError(t, err)
+	var checks int
+	require.NoError(t, session.QueryRow("SELECT @@FOREIGN_KEY_CHECKS;").Scan(&checks))
+	assert.Equal(t, 1, checks)
+}
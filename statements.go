@@ -0,0 +1,202 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChunkedDelete deletes the rows of table matching where, at most
+// chunkSize rows at a time, until no more rows are affected. Deleting in
+// chunks keeps each statement's locks and replication events small. The
+// args are bound to where for every chunk, and an empty where deletes
+// every row. The total number of rows deleted is returned, including when
+// ctx is cancelled between chunks.
+func ChunkedDelete(ctx context.Context, c Conn, table, where string, chunkSize int, args ...interface{}) (int64, error) {
+	if chunkSize <= 0 {
+		return 0, errors.New("chunk size must be positive")
+	}
+
+	quoted, err := QuoteIdentifier(table)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "DELETE FROM " + quoted
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " LIMIT " + strconv.Itoa(chunkSize) + ";"
+
+	var total int64
+	for {
+		if err = ctx.Err(); err != nil {
+			return total, err
+		}
+
+		res, err := c.Exec(query, args...)
+		if err != nil {
+			return total, fmt.Errorf("deleting chunk: %w", err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("reading rows affected: %w", err)
+		}
+		total += n
+
+		if n == 0 {
+			return total, nil
+		}
+	}
+}
+
+// quoteIdentifiers quotes each of names with QuoteIdentifier.
+func quoteIdentifiers(names []string) ([]string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		q, err := QuoteIdentifier(name)
+		if err != nil {
+			return nil, err
+		}
+		quoted[i] = q
+	}
+	return quoted, nil
+}
+
+// buildInsert builds an insert of rows into the given columns of table,
+// starting with verb e.g. "INSERT" or "INSERT IGNORE". The statement is
+// returned without a terminating semi-colon so clauses can be appended.
+func buildInsert(verb, table string, columns []string, rows [][]interface{}) (string, []interface{}, error) {
+	if len(columns) == 0 {
+		return "", nil, errors.New("no columns to insert")
+	}
+	if len(rows) == 0 {
+		return "", nil, errors.New("no rows to insert")
+	}
+
+	quotedTable, err := QuoteIdentifier(table)
+	if err != nil {
+		return "", nil, err
+	}
+	quotedColumns, err := quoteIdentifiers(columns)
+	if err != nil {
+		return "", nil, err
+	}
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	values := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return "", nil, fmt.Errorf("row %d has %d values for %d columns", i, len(row), len(columns))
+		}
+		values[i] = placeholders
+		args = append(args, row...)
+	}
+
+	query := verb + " INTO " + quotedTable + " (" + strings.Join(quotedColumns, ", ") + ") VALUES " + strings.Join(values, ", ")
+	return query, args, nil
+}
+
+// Upsert inserts rows into the given columns of table, updating the
+// updateColumns of any existing row with a conflicting primary or unique
+// key to the values that would have been inserted.
+func Upsert(c Conn, table string, columns []string, rows [][]interface{}, updateColumns []string) (sql.Result, error) {
+	query, args, err := buildUpsert(table, columns, rows, updateColumns)
+	if err != nil {
+		return nil, err
+	}
+	return c.Exec(query, args...)
+}
+
+func buildUpsert(table string, columns []string, rows [][]interface{}, updateColumns []string) (string, []interface{}, error) {
+	if len(updateColumns) == 0 {
+		return "", nil, errors.New("no columns to update")
+	}
+
+	query, args, err := buildInsert("INSERT", table, columns, rows)
+	if err != nil {
+		return "", nil, err
+	}
+
+	quoted, err := quoteIdentifiers(updateColumns)
+	if err != nil {
+		return "", nil, err
+	}
+	updates := make([]string, len(quoted))
+	for i, column := range quoted {
+		updates[i] = column + " = VALUES(" + column + ")"
+	}
+
+	return query + " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ") + ";", args, nil
+}
+
+// InsertIgnore inserts values into the given columns of table with
+// INSERT IGNORE, so a row conflicting with an existing primary or unique
+// key is skipped rather than failing. The result's RowsAffected is 0
+// when the row was skipped.
+func InsertIgnore(c Conn, table string, columns []string, values []interface{}) (sql.Result, error) {
+	query, args, err := buildInsert("INSERT IGNORE", table, columns, [][]interface{}{values})
+	if err != nil {
+		return nil, err
+	}
+	return c.Exec(query+";", args...)
+}
+
+// Exists reports whether query returns any rows, by running it as
+// SELECT EXISTS(query).
+func Exists(c Conn, query string, args ...interface{}) (bool, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+
+	var exists Bool
+	if err := c.QueryRow("SELECT EXISTS("+query+");", args...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("querying for existence: %w", err)
+	}
+	return bool(exists), nil
+}
+
+// explainableVerbs are the leading verbs of the statements Explain accepts.
+var explainableVerbs = map[string]bool{
+	"SELECT":  true,
+	"TABLE":   true,
+	"WITH":    true,
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+}
+
+// Explain returns the plan MySQL would use to run query, a SELECT or DML
+// statement, as reported by EXPLAIN in its tabular format. Each row of the
+// plan is a map keyed by column name, such as table, type, key and rows,
+// with values converted as by ScanRowToMap. The query isn't run, although
+// MySQL may run subqueries in the FROM clause to plan the rest.
+func (db *DB) Explain(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	verb, _ := firstWord(query)
+	if !explainableVerbs[strings.ToUpper(verb)] {
+		return nil, fmt.Errorf("can't explain a %s statement", verb)
+	}
+
+	rows, err := db.Query("EXPLAIN "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("explaining query: %w", err)
+	}
+	defer rows.Close()
+
+	plan := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		step, err := ScanRowToMap(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning plan: %w", err)
+		}
+		plan = append(plan, step)
+	}
+	if err = rowsErr(rows); err != nil {
+		return nil, fmt.Errorf("iterating plan: %w", err)
+	}
+	return plan, nil
+}
@@ -0,0 +1,209 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkedDeleteHandler simulates deleting from a table of remaining rows
+// in chunks of at most chunk rows.
+func chunkedDeleteHandler(remaining, chunk int64) func(q fakeQuery) (fakeResult, error) {
+	var mu sync.Mutex
+	return func(q fakeQuery) (fakeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n := chunk
+		if remaining < n {
+			n = remaining
+		}
+		remaining -= n
+		return fakeResult{affected: n}, nil
+	}
+}
+
+func TestChunkedDelete(t *testing.T) {
+	srv := newFakeServer(t, chunkedDeleteHandler(25, 10))
+	db := &DB{db: srv.open(t)}
+
+	total, err := ChunkedDelete(context.Background(), db, "events", "CreatedAt < ?", 10, "2024-01-01")
+	require.NoError(t, err)
+	assert.EqualValues(t, 25, total)
+
+	queries := srv.queries()
+	require.Len(t, queries, 4)
+	assert.Equal(t, "DELETE FROM `events` WHERE CreatedAt < ? LIMIT 10;", queries[0])
+}
+
+func TestChunkedDeleteCancelled(t *testing.T) {
+	srv := newFakeServer(t, chunkedDeleteHandler(25, 10))
+	db := &DB{db: srv.open(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	total, err := ChunkedDelete(ctx, db, "events", "", 10)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, total)
+	assert.Empty(t, srv.queries())
+}
+
+func TestChunkedDeleteInvalidTable(t *testing.T) {
+	_, err := ChunkedDelete(context.Background(), &DB{}, "", "", 10)
+	assert.Error(t, err)
+}
+
+// upsertHandler simulates upserts into a table keyed by its first column,
+// reporting rows affected the way MySQL does: 1 for an insert and 2 for
+// an update.
+func upsertHandler(existing map[interface{}]bool) func(q fakeQuery) (fakeResult, error) {
+	return func(q fakeQuery) (fakeResult, error) {
+		if !strings.HasPrefix(q.query, "INSERT") {
+			return fakeResult{}, nil
+		}
+		if existing[q.args[0]] {
+			return fakeResult{affected: 2}, nil
+		}
+		existing[q.args[0]] = true
+		return fakeResult{affected: 1}, nil
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	srv := newFakeServer(t, upsertHandler(map[interface{}]bool{}))
+	db := &DB{db: srv.open(t)}
+
+	columns := []string{"id", "name", "email"}
+	for _, want := range []int64{1, 2} {
+		res, err := Upsert(db, "users", columns, [][]interface{}{{int64(1), "gavin", "g@example.com"}}, []string{"name", "email"})
+		require.NoError(t, err)
+		n, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+
+	assert.Equal(t,
+		"INSERT INTO `users` (`id`, `name`, `email`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `email` = VALUES(`email`);",
+		srv.queries()[0])
+}
+
+func TestBuildUpsertMultipleRows(t *testing.T) {
+	query, args, err := buildUpsert("users", []string{"id", "name"}, [][]interface{}{{1, "a"}, {2, "b"}}, []string{"name"})
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `users` (`id`, `name`) VALUES (?, ?), (?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`);", query)
+	assert.Equal(t, []interface{}{1, "a", 2, "b"}, args)
+}
+
+func TestBuildUpsertInvalid(t *testing.T) {
+	_, _, err := buildUpsert("users", []string{"id", "name"}, [][]interface{}{{1}}, []string{"name"})
+	assert.Error(t, err, "mismatched row width")
+
+	_, _, err = buildUpsert("users", []string{"id", ""}, [][]interface{}{{1, "a"}}, []string{"name"})
+	assert.Error(t, err, "invalid column")
+
+	_, _, err = buildUpsert("users", []string{"id", "name"}, [][]interface{}{{1, "a"}}, nil)
+	assert.Error(t, err, "no update columns")
+}
+
+func TestInsertIgnore(t *testing.T) {
+	existing := map[interface{}]bool{}
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if existing[q.args[0]] {
+			return fakeResult{}, nil
+		}
+		existing[q.args[0]] = true
+		return fakeResult{affected: 1}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	for _, want := range []int64{1, 0} {
+		res, err := InsertIgnore(db, "users", []string{"id", "name"}, []interface{}{int64(1), "gavin"})
+		require.NoError(t, err)
+		n, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, want, n)
+	}
+
+	assert.Equal(t, "INSERT IGNORE INTO `users` (`id`, `name`) VALUES (?, ?);", srv.queries()[0])
+}
+
+func TestInsertIgnoreInvalid(t *testing.T) {
+	db := &DB{db: newFakeServer(t, nil).open(t)}
+
+	_, err := InsertIgnore(db, "users", []string{"id", "name"}, []interface{}{1})
+	assert.Error(t, err, "mismatched width")
+
+	_, err = InsertIgnore(db, "", []string{"id"}, []interface{}{1})
+	assert.Error(t, err, "invalid table")
+}
+
+func TestExists(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		exists := int64(0)
+		if q.args[0] == "gavin" {
+			exists = 1
+		}
+		return fakeResult{columns: []string{"exists"}, rows: [][]driver.Value{{exists}}}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	exists, err := Exists(db, "SELECT 1 FROM users WHERE name = ?;", "gavin")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "SELECT EXISTS(SELECT 1 FROM users WHERE name = ?);", srv.queries()[0])
+
+	exists, err = Exists(db, "SELECT 1 FROM users WHERE name = ?", "wade")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// explainHandler answers EXPLAIN with a single step scanning users.
+func explainHandler(q fakeQuery) (fakeResult, error) {
+	if !strings.HasPrefix(q.query, "EXPLAIN ") {
+		return fakeResult{}, errors.New("unexpected query: " + q.query)
+	}
+	return fakeResult{
+		columns: []string{"id", "select_type", "table", "type", "key", "rows", "filtered", "Extra"},
+		types:   []string{"BIGINT", "VARCHAR", "VARCHAR", "VARCHAR", "VARCHAR", "BIGINT", "DOUBLE", "VARCHAR"},
+		rows:    [][]driver.Value{{[]byte("1"), []byte("SIMPLE"), []byte("users"), []byte("ref"), []byte("idx_name"), []byte("1"), []byte("100"), nil}},
+	}, nil
+}
+
+func TestExplain(t *testing.T) {
+	srv := newFakeServer(t, explainHandler)
+	db := &DB{db: srv.open(t)}
+
+	plan, err := db.Explain("SELECT id FROM users WHERE name = ?;", "gavin")
+	require.NoError(t, err)
+	require.NotEmpty(t, plan)
+	assert.Equal(t, map[string]interface{}{
+		"id":          int64(1),
+		"select_type": "SIMPLE",
+		"table":       "users",
+		"type":        "ref",
+		"key":         "idx_name",
+		"rows":        int64(1),
+		"filtered":    float64(100),
+		"Extra":       nil,
+	}, plan[0])
+	assert.Equal(t, "EXPLAIN SELECT id FROM users WHERE name = ?;", srv.queries()[0])
+
+	_, err = db.Explain("DELETE FROM users WHERE name = ?;", "gavin")
+	require.NoError(t, err)
+	assert.Equal(t, "EXPLAIN DELETE FROM users WHERE name = ?;", srv.queries()[1])
+}
+
+func TestExplainInvalid(t *testing.T) {
+	srv := newFakeServer(t, explainHandler)
+	db := &DB{db: srv.open(t)}
+
+	_, err := db.Explain("DROP TABLE users;")
+	assert.Error(t, err)
+	assert.Empty(t, srv.queries())
+}
@@ -0,0 +1,44 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Stats returns the current statistics of the DB's connection pool.
+func (db *DB) Stats() sql.DBStats {
+	return db.sqlDB().Stats()
+}
+
+// StartStatsCollector samples the statistics of the DB's connection pool
+// every interval and passes them to sink, such as to export them as
+// metrics, until ctx is done. Sampling happens in its own goroutine, so
+// StartStatsCollector returns straight away, and sink is never called
+// concurrently with itself. It returns an error, without starting, if
+// interval isn't positive.
+func (db *DB) StartStatsCollector(ctx context.Context, interval time.Duration, sink func(sql.DBStats)) error {
+	if interval <= 0 {
+		return errors.New("stats interval must be positive")
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// prefer stopping over a sample that's ready at the same time
+			if ctx.Err() != nil {
+				return
+			}
+			sink(db.Stats())
+		}
+	}()
+	return nil
+}
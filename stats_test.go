@@ -0,0 +1,67 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+	db.sqlDB().SetMaxOpenConns(3)
+
+	_, err := db.Exec("SELECT 1;")
+	require.NoError(t, err)
+	stats := db.Stats()
+	assert.Equal(t, 3, stats.MaxOpenConnections)
+	assert.Equal(t, 1, stats.OpenConnections)
+}
+
+func TestStartStatsCollector(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+	db.sqlDB().SetMaxOpenConns(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	samples := make(chan sql.DBStats, 100)
+	var calls int32
+	err := db.StartStatsCollector(ctx, time.Millisecond, func(stats sql.DBStats) {
+		atomic.AddInt32(&calls, 1)
+		samples <- stats
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case stats := <-samples:
+			assert.Equal(t, 3, stats.MaxOpenConnections)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d samples, want 3", i)
+		}
+	}
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	stopped := atomic.LoadInt32(&calls)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stopped, atomic.LoadInt32(&calls), "no samples after ctx is done")
+}
+
+func TestStartStatsCollectorInvalidInterval(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		err := db.StartStatsCollector(context.Background(), interval, func(sql.DBStats) {
+			t.Error("sink called")
+		})
+		assert.Error(t, err, "%s", interval)
+	}
+}
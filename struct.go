@@ -0,0 +1,349 @@
+package mysqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// structField is an exported struct field mapped to a column.
+type structField struct {
+	column string
+	index  []int
+	pk     bool
+}
+
+// structFields returns the column mapped fields of the struct type t.
+// Fields are named by their `db` tag, falling back to the field name
+// passed through mapper, if it isn't nil. Fields tagged `db:"-"` and
+// unexported fields are skipped, and the fields of embedded structs are
+// flattened into the result.
+func structFields(t reflect.Type, mapper func(string) string) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && !hasTag {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for _, ef := range structFields(ft, mapper) {
+					ef.index = append([]int{i}, ef.index...)
+					fields = append(fields, ef)
+				}
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+			if mapper != nil {
+				name = mapper(name)
+			}
+		}
+
+		sf := structField{column: name, index: []int{i}}
+		for opts != "" {
+			var opt string
+			opt, opts, _ = strings.Cut(opts, ",")
+			if opt == "pk" {
+				sf.pk = true
+			}
+		}
+		fields = append(fields, sf)
+	}
+
+	return fields
+}
+
+// WithFieldMapper returns an option that will configure the DB to name
+// the columns of untagged struct fields by passing the field name through
+// mapper, rather than using it as is. SnakeCase maps conventional field
+// names to conventional column names e.g. CreatedAt to created_at. The
+// mapper is used by the struct helpers, such as Update and QueryStructs,
+// for the DB and its transactions.
+func WithFieldMapper(mapper func(string) string) Option {
+	return func(db *DB) {
+		db.fieldMapper = mapper
+	}
+}
+
+// fieldMapperConn is implemented by a Conn configured with a field mapper.
+type fieldMapperConn interface {
+	mapField() func(string) string
+}
+
+func (db *DB) mapField() func(string) string {
+	return db.fieldMapper
+}
+
+func (tx *Tx) mapField() func(string) string {
+	return tx.fieldMapper
+}
+
+// fieldMapperOf returns the field mapper c is configured with, if any.
+func fieldMapperOf(c Conn) func(string) string {
+	if mc, ok := c.(fieldMapperConn); ok {
+		return mc.mapField()
+	}
+	return nil
+}
+
+// SnakeCase converts a Go identifier to snake_case, keeping initialisms
+// together e.g. CreatedAt becomes created_at and UserID becomes user_id.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// structValue returns the struct value held by v, dereferencing pointers.
+func structValue(v interface{}) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("expected a struct, got %T", v)
+	}
+	return rv, nil
+}
+
+// fieldByIndex returns the field of rv at index. The bool is false if
+// the field is reached through a nil embedded pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, true
+}
+
+// StructArgs returns the column mapped fields of v, which must be a
+// struct or a pointer to one, keyed by column name for use as the
+// arguments of a query with named parameters. Fields are named as for
+// Update, without a field mapper, and fields reached through a nil
+// embedded pointer are left out. It returns nil if v isn't a struct.
+func StructArgs(v interface{}) map[string]interface{} {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil
+	}
+
+	fields := structFields(rv.Type(), nil)
+	args := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		if fv, ok := fieldByIndex(rv, f.index); ok {
+			args[f.column] = fv.Interface()
+		}
+	}
+	return args
+}
+
+// Update updates the row in table identified by the primary key of v.
+// v must be a struct, or a pointer to one, with exactly one field tagged
+// as the primary key e.g. `db:"id,pk"`. Every other field is included
+// in the SET list.
+func Update(c Conn, table string, v interface{}) (sql.Result, error) {
+	query, args, err := buildUpdate(table, v, fieldMapperOf(c))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Exec(query, args...)
+}
+
+func buildUpdate(table string, v interface{}, mapper func(string) string) (string, []interface{}, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var (
+		set   []string
+		args  []interface{}
+		pk    *structField
+		pkArg interface{}
+	)
+	fields := structFields(rv.Type(), mapper)
+	for i := range fields {
+		f := &fields[i]
+		fv, ok := fieldByIndex(rv, f.index)
+		if f.pk {
+			if pk != nil {
+				return "", nil, fmt.Errorf("multiple primary key fields in %T", v)
+			}
+			if !ok {
+				return "", nil, fmt.Errorf("primary key field in %T is unreachable", v)
+			}
+			pk, pkArg = f, fv.Interface()
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		column, err := QuoteIdentifier(f.column)
+		if err != nil {
+			return "", nil, err
+		}
+		set = append(set, column+" = ?")
+		args = append(args, fv.Interface())
+	}
+
+	if pk == nil {
+		return "", nil, fmt.Errorf("no primary key field tagged in %T", v)
+	}
+	if len(set) == 0 {
+		return "", nil, fmt.Errorf("no columns to update in %T", v)
+	}
+
+	quotedTable, err := QuoteIdentifier(table)
+	if err != nil {
+		return "", nil, err
+	}
+	quotedPK, err := QuoteIdentifier(pk.column)
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := "UPDATE " + quotedTable + " SET " + strings.Join(set, ", ") + " WHERE " + quotedPK + " = ?;"
+	return query, append(args, pkArg), nil
+}
+
+// QueryStructs runs query and scans every row it returns into a T, which
+// must be a struct. Columns are matched to fields in the same way as
+// Update, and it's an error for a column to have no matching field.
+func QueryStructs[T any](c Conn, query string, args ...interface{}) ([]T, error) {
+	values := make([]T, 0)
+	err := queryStructs(c, query, args, func(v T) bool {
+		values = append(values, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// QueryRowStruct is like QueryStructs, but scans only the first row the
+// query returns. It returns ErrNotFound if the query returns no rows.
+func QueryRowStruct[T any](c Conn, query string, args ...interface{}) (T, error) {
+	var (
+		value T
+		found bool
+	)
+	err := queryStructs(c, query, args, func(v T) bool {
+		value, found = v, true
+		return false
+	})
+	if err == nil && !found {
+		err = ErrNotFound
+	}
+	return value, err
+}
+
+// queryStructs runs query and scans the rows it returns into a T, passing
+// each to fn until fn returns false.
+func queryStructs[T any](c Conn, query string, args []interface{}, fn func(T) bool) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("expected a struct, got %s", t)
+	}
+
+	byColumn := make(map[string][]int)
+	for _, f := range structFields(t, fieldMapperOf(c)) {
+		byColumn[f.column] = f.index
+	}
+
+	rows, err := c.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("querying: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rowColumns(rows)
+	if err != nil {
+		return err
+	}
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		index, ok := byColumn[column]
+		if !ok {
+			return fmt.Errorf("column %s has no matching field in %s", column, t)
+		}
+		indexes[i] = index
+	}
+
+	dest := make([]interface{}, len(columns))
+	for rows.Next() {
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		for i, index := range indexes {
+			fv, err := allocFieldByIndex(rv, index)
+			if err != nil {
+				return fmt.Errorf("field for column %s: %w", columns[i], err)
+			}
+			dest[i] = fv.Addr().Interface()
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return fmt.Errorf("scanning row: %w", err)
+		}
+		if !fn(v) {
+			return nil
+		}
+	}
+	if err = rowsErr(rows); err != nil {
+		return fmt.Errorf("iterating rows: %w", err)
+	}
+	return nil
+}
+
+// allocFieldByIndex returns the field of rv at index, allocating any nil
+// embedded pointers it's reached through.
+func allocFieldByIndex(rv reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				if !rv.CanSet() {
+					return reflect.Value{}, fmt.Errorf("can't allocate unexported embedded %s", rv.Type())
+				}
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(x)
+	}
+	return rv, nil
+}
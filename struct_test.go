@@ -0,0 +1,210 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	ID      int64  `db:"id,pk"`
+	Name    string `db:"name"`
+	Email   string `db:"email"`
+	Ignored string `db:"-"`
+}
+
+func TestBuildUpdateExcludesPK(t *testing.T) {
+	query, args, err := buildUpdate("users", testUser{ID: 7, Name: "gavin", Email: "g@example.com"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "UPDATE `users` SET `name` = ?, `email` = ? WHERE `id` = ?;", query)
+	assert.Equal(t, []interface{}{"gavin", "g@example.com", int64(7)}, args)
+}
+
+func TestBuildUpdateRequiresPK(t *testing.T) {
+	type noPK struct {
+		Name string `db:"name"`
+	}
+	_, _, err := buildUpdate("users", noPK{Name: "gavin"}, nil)
+	assert.Error(t, err)
+}
+
+func TestUpdateByPK(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{affected: 1}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	res, err := Update(db, "users", &testUser{ID: 7, Name: "gavin"})
+	require.NoError(t, err)
+	n, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, n)
+	assert.Equal(t, []string{"UPDATE `users` SET `name` = ?, `email` = ? WHERE `id` = ?;"}, srv.queries())
+}
+
+func TestStructArgs(t *testing.T) {
+	type audit struct {
+		CreatedBy string `db:"created_by"`
+	}
+	type timestamps struct {
+		UpdatedAt string `db:"updated_at"`
+	}
+	type post struct {
+		audit
+		*timestamps
+		ID     int64 `db:"id,pk"`
+		Title  string
+		Secret string `db:"-"`
+		draft  bool
+	}
+
+	args := StructArgs(&post{audit: audit{CreatedBy: "gavin"}, ID: 7, Title: "Hello", Secret: "s", draft: true})
+	assert.Equal(t, map[string]interface{}{
+		"created_by": "gavin",
+		"id":         int64(7),
+		"Title":      "Hello",
+	}, args)
+
+	args = StructArgs(post{timestamps: &timestamps{UpdatedAt: "today"}})
+	assert.Equal(t, "today", args["updated_at"])
+
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "name": "gavin", "email": ""}, StructArgs(testUser{ID: 1, Name: "gavin"}))
+	assert.Nil(t, StructArgs(42))
+	assert.Nil(t, StructArgs((*post)(nil)))
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"Name":        "name",
+		"CreatedAt":   "created_at",
+		"ID":          "id",
+		"UserID":      "user_id",
+		"HTTPServer":  "http_server",
+		"Address2":    "address2",
+		"APIKey2Hash": "api_key2_hash",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, SnakeCase(name), name)
+	}
+}
+
+type testAudit struct {
+	CreatedAt string
+}
+
+type testPost struct {
+	ID     int64 `db:"id,pk"`
+	UserID int64
+	Title  string
+	testAudit
+}
+
+func postsHandler(q fakeQuery) (fakeResult, error) {
+	return fakeResult{
+		columns: []string{"id", "user_id", "title", "created_at"},
+		rows: [][]driver.Value{
+			{int64(1), int64(7), "hello", "2024-01-02"},
+			{int64(2), int64(7), "again", "2024-01-03"},
+		},
+	}, nil
+}
+
+func TestQueryStructsSnakeCase(t *testing.T) {
+	srv := newFakeServer(t, postsHandler)
+	db := &DB{db: srv.open(t)}
+	WithFieldMapper(SnakeCase)(db)
+
+	posts, err := QueryStructs[testPost](db, "SELECT id, user_id, title, created_at FROM posts;")
+	require.NoError(t, err)
+	assert.Equal(t, []testPost{
+		{ID: 1, UserID: 7, Title: "hello", testAudit: testAudit{CreatedAt: "2024-01-02"}},
+		{ID: 2, UserID: 7, Title: "again", testAudit: testAudit{CreatedAt: "2024-01-03"}},
+	}, posts)
+
+	tx, err := db.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = Update(tx, "posts", posts[0])
+	require.NoError(t, err)
+	assert.Contains(t, srv.queries(), "UPDATE `posts` SET `user_id` = ?, `title` = ?, `created_at` = ? WHERE `id` = ?;")
+}
+
+// The query helpers take a Conn, so they work on both a DB and a Tx.
+var (
+	_ func(Conn, string, ...interface{}) ([]testPost, error) = QueryStructs[testPost]
+	_ func(Conn, string, ...interface{}) (testPost, error)   = QueryRowStruct[testPost]
+	_ func(Conn, string, ...interface{}) (int64, error)      = QueryScalar[int64]
+)
+
+func TestQueryRowStruct(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.Contains(q.query, "WHERE id = 3") {
+			return fakeResult{columns: []string{"id", "user_id", "title", "created_at"}}, nil
+		}
+		return postsHandler(q)
+	})
+	db := &DB{db: srv.open(t)}
+	WithFieldMapper(SnakeCase)(db)
+
+	post, err := QueryRowStruct[testPost](db, "SELECT id, user_id, title, created_at FROM posts;")
+	require.NoError(t, err)
+	assert.Equal(t, testPost{ID: 1, UserID: 7, Title: "hello", testAudit: testAudit{CreatedAt: "2024-01-02"}}, post)
+
+	_, err = QueryRowStruct[testPost](db, "SELECT id, user_id, title, created_at FROM posts WHERE id = 3;")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQueryHelpersOnDBAndTx(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		if strings.HasPrefix(q.query, "SELECT COUNT(*)") {
+			return fakeResult{columns: []string{"n"}, rows: [][]driver.Value{{int64(2)}}}, nil
+		}
+		return postsHandler(q)
+	})
+	db := &DB{db: srv.open(t)}
+	WithFieldMapper(SnakeCase)(db)
+
+	tx, err := db.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	const query = "SELECT id, user_id, title, created_at FROM posts;"
+	results := make([][]interface{}, 0, 2)
+	for _, c := range []Conn{db, tx} {
+		posts, err := QueryStructs[testPost](c, query)
+		require.NoError(t, err)
+		post, err := QueryRowStruct[testPost](c, query)
+		require.NoError(t, err)
+		n, err := QueryScalar[int64](c, "SELECT COUNT(*) FROM posts;")
+		require.NoError(t, err)
+		results = append(results, []interface{}{posts, post, n})
+	}
+	assert.Equal(t, results[0], results[1])
+	assert.Len(t, results[0][0], 2)
+	assert.EqualValues(t, 2, results[0][2])
+}
+
+func TestQueryStructsCustomMapper(t *testing.T) {
+	srv := newFakeServer(t, postsHandler)
+	db := &DB{db: srv.open(t)}
+	WithFieldMapper(func(name string) string {
+		return map[string]string{"UserID": "user_id", "Title": "title", "CreatedAt": "created_at"}[name]
+	})(db)
+
+	posts, err := QueryStructs[testPost](db, "SELECT id, user_id, title, created_at FROM posts;")
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, "again", posts[1].Title)
+}
+
+func TestQueryStructsUnmatchedColumn(t *testing.T) {
+	srv := newFakeServer(t, postsHandler)
+	db := &DB{db: srv.open(t)}
+
+	_, err := QueryStructs[testPost](db, "SELECT id, user_id, title, created_at FROM posts;")
+	assert.ErrorContains(t, err, "user_id")
+}
@@ -0,0 +1,116 @@
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// CountingTx is a Tx that totals the rows affected by its Exec calls.
+type CountingTx struct {
+	*Tx
+	affected int64
+}
+
+// WithRowCounting returns a CountingTx wrapping tx. Only statements
+// executed through the returned CountingTx are counted.
+func (tx *Tx) WithRowCounting() *CountingTx {
+	return &CountingTx{Tx: tx}
+}
+
+func (tx *CountingTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	res, err := tx.Tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if n, err := res.RowsAffected(); err == nil {
+		atomic.AddInt64(&tx.affected, n)
+	}
+	return res, nil
+}
+
+// AffectedTotal returns the total rows affected by the statements
+// executed so far.
+func (tx *CountingTx) AffectedTotal() int64 {
+	return atomic.LoadInt64(&tx.affected)
+}
+
+// BeginTxWithDeadline starts a transaction that must complete by deadline.
+// Every statement run in the transaction uses a context derived from ctx
+// with the deadline, so the whole transaction shares one budget. Once the
+// deadline has passed, statements fail straight away with the context's
+// error, and the transaction is rolled back.
+func (db *DB) BeginTxWithDeadline(ctx context.Context, deadline time.Time) (*Tx, error) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	tx, err := db.BeginTx(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	tx.ctx, tx.cancel = ctx, cancel
+	return tx, nil
+}
+
+// WithNested runs fn in a logically nested transaction using a savepoint.
+// If fn returns an error, only its work is rolled back to the savepoint
+// and the error is returned, leaving the rest of tx intact. Otherwise the
+// savepoint is released. WithNested can be called again on the Tx passed
+// to fn for deeper nesting. fn must not commit or roll back its Tx, since
+// that ends the whole transaction.
+func (tx *Tx) WithNested(fn func(*Tx) error) error {
+	nested := &Tx{tx: tx.tx, depth: tx.depth + 1, done: tx.done, fieldMapper: tx.fieldMapper, ctx: tx.ctx}
+	savepoint := "mysqldb_sp_" + strconv.Itoa(nested.depth)
+
+	if _, err := tx.tx.ExecContext(tx.context(), "SAVEPOINT "+savepoint+";"); err != nil {
+		return fmt.Errorf("creating savepoint: %w", err)
+	}
+
+	if err := fn(nested); err != nil {
+		if _, rerr := tx.tx.ExecContext(tx.context(), "ROLLBACK TO SAVEPOINT "+savepoint+";"); rerr != nil {
+			return fmt.Errorf("rolling back to savepoint after %v: %w", err, rerr)
+		}
+		return err
+	}
+
+	if _, err := tx.tx.ExecContext(tx.context(), "RELEASE SAVEPOINT "+savepoint+";"); err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+// ForEachSavepoint calls fn for each of items in tx, in order, with each
+// call nested in its own savepoint as by WithNested. When fn fails, only
+// that item's work is rolled back, and the remaining items are still
+// processed. It returns nil if every item succeeded. Otherwise, it
+// returns an error for each item, in the order of items, which is nil for
+// the items that succeeded.
+//
+// It's a function rather than a method of Tx since Go doesn't allow
+// methods to have type parameters.
+func ForEachSavepoint[T any](tx *Tx, items []T, fn func(*Tx, T) error) []error {
+	var errs []error
+	for i, item := range items {
+		err := tx.WithNested(func(tx *Tx) error {
+			return fn(tx, item)
+		})
+		if err == nil {
+			continue
+		}
+		if errs == nil {
+			errs = make([]error, len(items))
+		}
+		errs[i] = err
+	}
+	return errs
+}
+
+// WithoutForeignKeyChecks runs fn in tx with foreign key checks disabled.
+// Checks are enabled again once fn returns, even if it fails.
+func (tx *Tx) WithoutForeignKeyChecks(fn func(Conn) error) error {
+	return withoutForeignKeyChecks(tx, fn)
+}
@@ -0,0 +1,251 @@
+package mysqldb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountingTx(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(q.query, "UPDATE"):
+			return fakeResult{affected: 3}, nil
+		case strings.HasPrefix(q.query, "DELETE"):
+			return fakeResult{affected: 2}, nil
+		}
+		return fakeResult{}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	tx, err := db.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	counting := tx.WithRowCounting()
+	var c Conn = counting
+	_, err = c.Exec("UPDATE t SET a = 1;")
+	require.NoError(t, err)
+	_, err = c.Exec("DELETE FROM t WHERE a = 2;")
+	require.NoError(t, err)
+	_, err = c.Exec("UPDATE t SET a = 3;")
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 8, counting.AffectedTotal())
+	require.NoError(t, counting.Commit())
+}
+
+func beginTestTx(t *testing.T) (*Tx, *fakeServer) {
+	t.Helper()
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	tx, err := db.BeginTx(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { tx.Rollback() })
+	return tx, srv
+}
+
+func TestWithNestedSuccess(t *testing.T) {
+	tx, srv := beginTestTx(t)
+
+	require.NoError(t, tx.WithNested(func(tx *Tx) error {
+		_, err := tx.Exec("INSERT INTO t VALUES (1);")
+		return err
+	}))
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT mysqldb_sp_1;",
+		"INSERT INTO t VALUES (1);",
+		"RELEASE SAVEPOINT mysqldb_sp_1;",
+		"COMMIT",
+	}, srv.queries())
+}
+
+func TestWithNestedFailure(t *testing.T) {
+	tx, srv := beginTestTx(t)
+	innerErr := errors.New("inner failed")
+
+	_, err := tx.Exec("INSERT INTO t VALUES (1);")
+	require.NoError(t, err)
+	err = tx.WithNested(func(tx *Tx) error {
+		if _, err := tx.Exec("INSERT INTO t VALUES (2);"); err != nil {
+			return err
+		}
+		return innerErr
+	})
+	assert.ErrorIs(t, err, innerErr)
+	require.NoError(t, tx.Commit())
+
+	assert.Equal(t, []string{
+		"BEGIN",
+		"INSERT INTO t VALUES (1);",
+		"SAVEPOINT mysqldb_sp_1;",
+		"INSERT INTO t VALUES (2);",
+		"ROLLBACK TO SAVEPOINT mysqldb_sp_1;",
+		"COMMIT",
+	}, srv.queries())
+}
+
+func TestWithNestedDouble(t *testing.T) {
+	tx, srv := beginTestTx(t)
+	innerErr := errors.New("innermost failed")
+
+	require.NoError(t, tx.WithNested(func(tx *Tx) error {
+		if _, err := tx.Exec("INSERT INTO t VALUES (1);"); err != nil {
+			return err
+		}
+		err := tx.WithNested(func(tx *Tx) error {
+			if _, err := tx.Exec("INSERT INTO t VALUES (2);"); err != nil {
+				return err
+			}
+			return innerErr
+		})
+		assert.ErrorIs(t, err, innerErr)
+		return nil
+	}))
+
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT mysqldb_sp_1;",
+		"INSERT INTO t VALUES (1);",
+		"SAVEPOINT mysqldb_sp_2;",
+		"INSERT INTO t VALUES (2);",
+		"ROLLBACK TO SAVEPOINT mysqldb_sp_2;",
+		"RELEASE SAVEPOINT mysqldb_sp_1;",
+	}, srv.queries())
+}
+
+func TestForEachSavepoint(t *testing.T) {
+	// the rows of t, with the number of rows at each open savepoint
+	var rows, savepoints, persisted []int
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(q.query, "SAVEPOINT"):
+			savepoints = append(savepoints, len(rows))
+		case strings.HasPrefix(q.query, "ROLLBACK TO SAVEPOINT"):
+			rows = rows[:savepoints[len(savepoints)-1]]
+			savepoints = savepoints[:len(savepoints)-1]
+		case strings.HasPrefix(q.query, "RELEASE SAVEPOINT"):
+			savepoints = savepoints[:len(savepoints)-1]
+		case q.query == "INSERT INTO t VALUES (?);":
+			rows = append(rows, int(q.args[0].(int64)))
+		case q.query == "COMMIT":
+			persisted = append([]int(nil), rows...)
+		}
+		return fakeResult{affected: 1}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	tx, err := db.BeginTx(context.Background())
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	itemErr := errors.New("item failed")
+	errs := ForEachSavepoint(tx, []int{1, 2, 3}, func(tx *Tx, item int) error {
+		if _, err := tx.Exec("INSERT INTO t VALUES (?);", item); err != nil {
+			return err
+		}
+		if item == 2 {
+			return itemErr
+		}
+		return nil
+	})
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], itemErr)
+	assert.NoError(t, errs[2])
+
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, []int{1, 3}, persisted)
+	assert.Contains(t, srv.queries(), "ROLLBACK TO SAVEPOINT mysqldb_sp_1;")
+}
+
+func TestForEachSavepointSuccess(t *testing.T) {
+	tx, _ := beginTestTx(t)
+
+	errs := ForEachSavepoint(tx, []string{"a", "b"}, func(tx *Tx, item string) error {
+		_, err := tx.Exec("INSERT INTO t VALUES (?);", item)
+		return err
+	})
+	assert.Nil(t, errs)
+}
+
+func TestTxWithoutForeignKeyChecks(t *testing.T) {
+	tx, srv := beginTestTx(t)
+
+	err := tx.WithoutForeignKeyChecks(func(c Conn) error {
+		_, err := c.Exec("INSERT INTO posts (user_id) VALUES (?);", 404)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SET FOREIGN_KEY_CHECKS = 0;",
+		"INSERT INTO posts (user_id) VALUES (?);",
+		"SET FOREIGN_KEY_CHECKS = 1;",
+	}, srv.queries())
+}
+
+func TestTxDoneAfterCommit(t *testing.T) {
+	tx, srv := beginTestTx(t)
+	assert.True(t, tx.Active())
+
+	require.NoError(t, tx.Commit())
+	assert.False(t, tx.Active())
+
+	_, err := tx.Exec("INSERT INTO users VALUES (1);")
+	assert.ErrorIs(t, err, ErrTxDone)
+	_, err = tx.Query("SELECT id FROM users;")
+	assert.ErrorIs(t, err, ErrTxDone)
+	var id int
+	assert.ErrorIs(t, tx.QueryRow("SELECT id FROM users;").Scan(&id), ErrTxDone)
+	assert.ErrorIs(t, tx.Commit(), ErrTxDone)
+	assert.ErrorIs(t, tx.Rollback(), ErrTxDone)
+
+	assert.Equal(t, []string{"BEGIN", "COMMIT"}, srv.queries())
+}
+
+func TestTxDoneAfterRollback(t *testing.T) {
+	tx, srv := beginTestTx(t)
+
+	require.NoError(t, tx.Rollback())
+	assert.False(t, tx.Active())
+
+	_, err := tx.Exec("INSERT INTO users VALUES (1);")
+	assert.ErrorIs(t, err, ErrTxDone)
+	assert.ErrorIs(t, tx.WithNested(func(*Tx) error { return nil }), ErrTxDone)
+	assert.Equal(t, []string{"BEGIN", "ROLLBACK"}, srv.queries())
+}
+
+func TestBeginTxWithDeadline(t *testing.T) {
+	srv := newFakeServer(t, nil)
+	db := &DB{db: srv.open(t)}
+
+	tx, err := db.BeginTxWithDeadline(context.Background(), time.Now().Add(50*time.Millisecond))
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO users VALUES (1);")
+	require.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = tx.Exec("INSERT INTO users VALUES (2);")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = tx.Query("SELECT id FROM users;")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var id int
+	assert.ErrorIs(t, tx.QueryRow("SELECT id FROM users;").Scan(&id), context.DeadlineExceeded)
+	assert.ErrorIs(t, tx.WithNested(func(*Tx) error { return nil }), context.DeadlineExceeded)
+	assert.Error(t, tx.Commit())
+
+	assert.NotContains(t, srv.queries(), "INSERT INTO users VALUES (2);")
+	assert.NotContains(t, srv.queries(), "COMMIT")
+}
@@ -0,0 +1,445 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enum is a nullable string restricted to a set of allowed values, such
+// as those of an ENUM column. Scanning or writing a value that isn't
+// allowed is an error, which catches drift between a model and the schema.
+type Enum struct {
+	String  string
+	Valid   bool // Valid is true if String is not NULL
+	allowed []string
+}
+
+// NewEnum returns an Enum that allows the given values.
+func NewEnum(allowed ...string) *Enum {
+	return &Enum{allowed: allowed}
+}
+
+func (e *Enum) allows(s string) bool {
+	for _, a := range e.allowed {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan implements the sql.Scanner interface.
+func (e *Enum) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		e.String, e.Valid = "", false
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("unexpected type for Enum: %T", src)
+	}
+
+	if !e.allows(s) {
+		return fmt.Errorf("enum value %q is not one of %q", s, e.allowed)
+	}
+	e.String, e.Valid = s, true
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (e Enum) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	if !e.allows(e.String) {
+		return nil, fmt.Errorf("enum value %q is not one of %q", e.String, e.allowed)
+	}
+	return e.String, nil
+}
+
+// wkbPoint is the WKB geometry type of a point.
+const wkbPoint = 1
+
+// Point is a nullable POINT value. It's scanned from and written as
+// MySQL's internal geometry format: a little-endian SRID followed by the
+// point's WKB representation.
+type Point struct {
+	X, Y  float64
+	SRID  uint32
+	Valid bool // Valid is true if the point is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (p *Point) Scan(src interface{}) error {
+	if src == nil {
+		*p = Point{}
+		return nil
+	}
+
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("unexpected type for Point: %T", src)
+	}
+	if len(b) != 25 {
+		return fmt.Errorf("unexpected length for Point: %d bytes", len(b))
+	}
+
+	var order binary.ByteOrder
+	switch b[4] {
+	case 0:
+		order = binary.BigEndian
+	case 1:
+		order = binary.LittleEndian
+	default:
+		return fmt.Errorf("unexpected WKB byte order: %d", b[4])
+	}
+
+	if t := order.Uint32(b[5:9]); t != wkbPoint {
+		return fmt.Errorf("unexpected geometry type for Point: %d", t)
+	}
+
+	*p = Point{
+		SRID:  binary.LittleEndian.Uint32(b[0:4]),
+		X:     math.Float64frombits(order.Uint64(b[9:17])),
+		Y:     math.Float64frombits(order.Uint64(b[17:25])),
+		Valid: true,
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (p Point) Value() (driver.Value, error) {
+	if !p.Valid {
+		return nil, nil
+	}
+
+	b := make([]byte, 25)
+	binary.LittleEndian.PutUint32(b[0:4], p.SRID)
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:9], wkbPoint)
+	binary.LittleEndian.PutUint64(b[9:17], math.Float64bits(p.X))
+	binary.LittleEndian.PutUint64(b[17:25], math.Float64bits(p.Y))
+	return b, nil
+}
+
+// Decimal is a nullable DECIMAL value. It holds the value's exact decimal
+// text, as returned by MySQL, so no precision is lost as it would be
+// scanning into a float64.
+type Decimal struct {
+	s     string
+	Valid bool // Valid is true if the decimal is not NULL
+}
+
+// NewDecimal returns the valid Decimal represented by s, such as
+// "-123.4500". It's an error if s isn't a plain decimal number.
+func NewDecimal(s string) (Decimal, error) {
+	if !isDecimal(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+	return Decimal{s: s, Valid: true}, nil
+}
+
+// isDecimal reports whether s is an optionally signed decimal number,
+// without an exponent.
+func isDecimal(s string) bool {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+
+	digits, point := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			digits++
+		case s[i] == '.' && !point:
+			point = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// String returns the exact decimal text of d, or an empty string if d is
+// NULL.
+func (d Decimal) String() string {
+	return d.s
+}
+
+// Rat returns d as an exact rational number, or nil if d is NULL.
+func (d Decimal) Rat() *big.Rat {
+	if !d.Valid {
+		return nil
+	}
+	r, _ := new(big.Rat).SetString(d.s)
+	return r
+}
+
+// Float64 returns the nearest float64 to d. exact is false if precision
+// was lost in the conversion, as it is for most decimal fractions. A NULL
+// decimal returns 0 and true.
+func (d Decimal) Float64() (f float64, exact bool) {
+	if !d.Valid {
+		return 0, true
+	}
+	return d.Rat().Float64()
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Decimal) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	default:
+		return fmt.Errorf("unexpected type for Decimal: %T", src)
+	}
+
+	dec, err := NewDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = dec
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (d Decimal) Value() (driver.Value, error) {
+	if !d.Valid {
+		return nil, nil
+	}
+	if !isDecimal(d.s) {
+		return nil, fmt.Errorf("invalid decimal: %q", d.s)
+	}
+	return d.s, nil
+}
+
+const (
+	// maxTime is the largest magnitude of a TIME value.
+	maxTime = 838*time.Hour + 59*time.Minute + 59*time.Second + 999999*time.Microsecond
+	// maxDuration is the largest time.Duration.
+	maxDuration = time.Duration(math.MaxInt64)
+)
+
+// Duration is a nullable TIME value. MySQL returns TIME values as text
+// such as "12:30:45", "-01:00:00" or "100:00:00.5", since they can be
+// negative or longer than a day, so they're scanned as a time.Duration
+// rather than a time.Time.
+type Duration struct {
+	Duration time.Duration
+	Valid    bool // Valid is true if Duration is not NULL
+}
+
+// parseTime parses a TIME value in the format [-]HH:MM:SS[.fraction],
+// where HH can have any number of digits.
+func parseTime(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid time: %q", s)
+
+	hms, frac, hasFrac := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	parts := strings.Split(hms, ":")
+	if len(parts) != 3 || len(parts[1]) != 2 || len(parts[2]) != 2 || hasFrac && (frac == "" || len(frac) > 9) {
+		return 0, invalid
+	}
+
+	h, err := parseDigits(parts[0])
+	if err != nil || h > int64(maxDuration/time.Hour) {
+		return 0, invalid
+	}
+	m, err := parseDigits(parts[1])
+	if err != nil || m > 59 {
+		return 0, invalid
+	}
+	sec, err := parseDigits(parts[2])
+	if err != nil || sec > 59 {
+		return 0, invalid
+	}
+	var ns int64
+	if hasFrac {
+		if ns, err = parseDigits(frac + strings.Repeat("0", 9-len(frac))); err != nil {
+			return 0, invalid
+		}
+	}
+
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(sec)*time.Second + time.Duration(ns)
+	if strings.HasPrefix(s, "-") {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseDigits parses s, which must consist only of decimal digits.
+func parseDigits(s string) (int64, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, fmt.Errorf("invalid digits: %q", s)
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// formatTime formats d as a TIME value, with microseconds if it has any.
+func formatTime(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+
+	d = d.Truncate(time.Microsecond)
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	us := d % time.Second / time.Microsecond
+	if us == 0 {
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, h, m, s)
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, h, m, s, us)
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Duration) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*d = Duration{}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("unexpected type for Duration: %T", src)
+	}
+
+	dur, err := parseTime(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration{Duration: dur, Valid: true}
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Durations are written
+// to microsecond precision, and it's an error for one to be outside the
+// range of a TIME value, -838:59:59 to 838:59:59.
+func (d Duration) Value() (driver.Value, error) {
+	if !d.Valid {
+		return nil, nil
+	}
+	if d.Duration > maxTime || d.Duration < -maxTime {
+		return nil, fmt.Errorf("duration %s is out of range for TIME", d.Duration)
+	}
+	return formatTime(d.Duration), nil
+}
+
+// Uint64 is a nullable BIGINT UNSIGNED value. Scanning such a column into
+// an int64 fails for values above math.MaxInt64, so Uint64 parses the
+// value as unsigned, and it's an error for it to be negative or too large
+// for a uint64 rather than wrapping around.
+type Uint64 struct {
+	Uint64 uint64
+	Valid  bool // Valid is true if Uint64 is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (u *Uint64) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*u = Uint64{}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case uint64:
+		*u = Uint64{Uint64: v, Valid: true}
+		return nil
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("invalid uint64: %d is negative", v)
+		}
+		*u = Uint64{Uint64: uint64(v), Valid: true}
+		return nil
+	default:
+		return fmt.Errorf("unexpected type for Uint64: %T", src)
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid uint64: %w", err)
+	}
+	*u = Uint64{Uint64: n, Valid: true}
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Values that fit in an
+// int64 are written as one, and larger values as a uint64, which the
+// MySQL driver accepts.
+func (u Uint64) Value() (driver.Value, error) {
+	if !u.Valid {
+		return nil, nil
+	}
+	if u.Uint64 > math.MaxInt64 {
+		return u.Uint64, nil
+	}
+	return int64(u.Uint64), nil
+}
+
+// Year is a YEAR value, which MySQL allows to be from 1901 to 2155, or 0.
+// Scan into a *Year for a nullable column.
+type Year int
+
+// checkYear returns an error if y is outside the range of a YEAR value.
+func checkYear(y int64) error {
+	if y != 0 && (y < 1901 || y > 2155) {
+		return fmt.Errorf("year %d is out of range for YEAR", y)
+	}
+	return nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (y *Year) Scan(src interface{}) error {
+	var n int64
+	switch v := src.(type) {
+	case []byte:
+		var err error
+		if n, err = parseDigits(string(v)); err != nil {
+			return fmt.Errorf("invalid year: %q", v)
+		}
+	case int64:
+		n = v
+	default:
+		return fmt.Errorf("unexpected type for Year: %T", src)
+	}
+
+	if err := checkYear(n); err != nil {
+		return err
+	}
+	*y = Year(n)
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (y Year) Value() (driver.Value, error) {
+	if err := checkYear(int64(y)); err != nil {
+		return nil, err
+	}
+	return int64(y), nil
+}
@@ -0,0 +1,298 @@
+package mysqldb
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnumValid(t *testing.T) {
+	e := NewEnum("active", "inactive")
+	require.NoError(t, e.Scan([]byte("active")))
+	assert.True(t, e.Valid)
+	assert.Equal(t, "active", e.String)
+
+	v, err := e.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "active", v)
+}
+
+func TestEnumInvalid(t *testing.T) {
+	e := NewEnum("active", "inactive")
+	assert.Error(t, e.Scan([]byte("deleted")))
+
+	e.String, e.Valid = "deleted", true
+	_, err := e.Value()
+	assert.Error(t, err)
+}
+
+func TestEnumNull(t *testing.T) {
+	e := NewEnum("active", "inactive")
+	require.NoError(t, e.Scan(nil))
+	assert.False(t, e.Valid)
+
+	v, err := e.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestPointRoundTrip(t *testing.T) {
+	// POINT(1 -2) with SRID 4326, as returned by MySQL
+	b, err := hex.DecodeString("e6100000" + "01" + "01000000" + "000000000000f03f" + "00000000000000c0")
+	require.NoError(t, err)
+
+	var p Point
+	require.NoError(t, p.Scan(b))
+	assert.Equal(t, Point{X: 1, Y: -2, SRID: 4326, Valid: true}, p)
+
+	v, err := p.Value()
+	require.NoError(t, err)
+	assert.Equal(t, b, v)
+}
+
+func TestPointBigEndian(t *testing.T) {
+	b, err := hex.DecodeString("00000000" + "00" + "00000001" + "3ff0000000000000" + "c000000000000000")
+	require.NoError(t, err)
+
+	var p Point
+	require.NoError(t, p.Scan(b))
+	assert.Equal(t, Point{X: 1, Y: -2, Valid: true}, p)
+}
+
+func TestPointInvalidGeometryType(t *testing.T) {
+	// a LINESTRING type byte with a point-sized payload
+	b, err := hex.DecodeString("00000000" + "01" + "02000000" + "000000000000f03f" + "00000000000000c0")
+	require.NoError(t, err)
+
+	var p Point
+	assert.Error(t, p.Scan(b))
+}
+
+func TestPointNull(t *testing.T) {
+	p := Point{X: 1, Valid: true}
+	require.NoError(t, p.Scan(nil))
+	assert.False(t, p.Valid)
+
+	v, err := p.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	var d Decimal
+	require.NoError(t, d.Scan([]byte("123.4500")))
+	assert.True(t, d.Valid)
+	assert.Equal(t, "123.4500", d.String())
+
+	v, err := d.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "123.4500", v)
+
+	assert.Equal(t, big.NewRat(24690, 200), d.Rat())
+	f, exact := d.Float64()
+	assert.Equal(t, 123.45, f)
+	assert.False(t, exact)
+}
+
+func TestDecimalPrecision(t *testing.T) {
+	// more significant digits than a float64 can hold
+	d, err := NewDecimal("12345678901234567890.123456789")
+	require.NoError(t, err)
+
+	v, err := d.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "12345678901234567890.123456789", v)
+	assert.Equal(t, "12345678901234567890123456789/1000000000", d.Rat().String())
+}
+
+func TestDecimalInvalid(t *testing.T) {
+	for _, s := range []string{"", "-", "1.2.3", "1e5", "1/3", "abc"} {
+		_, err := NewDecimal(s)
+		assert.Error(t, err, s)
+	}
+
+	var d Decimal
+	assert.Error(t, d.Scan(1.5))
+}
+
+func TestDecimalNull(t *testing.T) {
+	var d Decimal
+	require.NoError(t, d.Scan(nil))
+	assert.False(t, d.Valid)
+	assert.Nil(t, d.Rat())
+
+	v, err := d.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestDurationScan(t *testing.T) {
+	tests := map[string]time.Duration{
+		"12:30:45":        12*time.Hour + 30*time.Minute + 45*time.Second,
+		"00:00:00":        0,
+		"00:00:01.5":      1500 * time.Millisecond,
+		"12:30:45.000123": 12*time.Hour + 30*time.Minute + 45*time.Second + 123*time.Microsecond,
+		"100:00:00":       100 * time.Hour,
+		"838:59:59":       maxTime - 999999*time.Microsecond,
+		"-01:30:00":       -90 * time.Minute,
+		"-838:59:59.5":    -(838*time.Hour + 59*time.Minute + 59*time.Second + 500*time.Millisecond),
+	}
+	for s, want := range tests {
+		var d Duration
+		require.NoError(t, d.Scan([]byte(s)), s)
+		assert.True(t, d.Valid, s)
+		assert.Equal(t, want, d.Duration, s)
+	}
+}
+
+func TestDurationValue(t *testing.T) {
+	tests := map[time.Duration]string{
+		12*time.Hour + 30*time.Minute + 45*time.Second: "12:30:45",
+		26 * time.Hour:                    "26:00:00",
+		-90 * time.Minute:                 "-01:30:00",
+		1500 * time.Millisecond:           "00:00:01.500000",
+		time.Second + time.Nanosecond:     "00:00:01",
+		-(time.Second + time.Microsecond): "-00:00:01.000001",
+	}
+	for d, want := range tests {
+		v, err := Duration{Duration: d, Valid: true}.Value()
+		require.NoError(t, err, d)
+		assert.Equal(t, want, v, d)
+
+		var scanned Duration
+		require.NoError(t, scanned.Scan(v))
+		assert.Equal(t, d.Truncate(time.Microsecond), scanned.Duration)
+	}
+
+	_, err := Duration{Duration: 839 * time.Hour, Valid: true}.Value()
+	assert.Error(t, err)
+}
+
+func TestDurationInvalid(t *testing.T) {
+	for _, s := range []string{"", "12:30", "12:3:45", "12:30:60", "12:60:00", "aa:bb:cc", "12:30:45.", "1:2:3:4", "--01:00:00", "12:30:45.1234567890"} {
+		var d Duration
+		assert.Error(t, d.Scan(s), s)
+	}
+
+	var d Duration
+	assert.Error(t, d.Scan(int64(5)))
+}
+
+func TestDurationNull(t *testing.T) {
+	d := Duration{Duration: time.Hour, Valid: true}
+	require.NoError(t, d.Scan(nil))
+	assert.Equal(t, Duration{}, d)
+
+	v, err := d.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestUint64Scan(t *testing.T) {
+	var u Uint64
+	require.NoError(t, u.Scan([]byte("18446744073709551615")))
+	assert.Equal(t, Uint64{Uint64: math.MaxUint64, Valid: true}, u)
+
+	require.NoError(t, u.Scan(uint64(math.MaxInt64)+1))
+	assert.Equal(t, uint64(math.MaxInt64)+1, u.Uint64)
+
+	require.NoError(t, u.Scan(int64(42)))
+	assert.Equal(t, uint64(42), u.Uint64)
+
+	require.NoError(t, u.Scan("9223372036854775808"))
+	assert.Equal(t, uint64(9223372036854775808), u.Uint64)
+}
+
+func TestUint64ScanFromDriver(t *testing.T) {
+	srv := newFakeServer(t, func(q fakeQuery) (fakeResult, error) {
+		return fakeResult{
+			columns: []string{"id"},
+			types:   []string{"UNSIGNED BIGINT"},
+			rows:    [][]driver.Value{{[]byte("9223372036854775809")}},
+		}, nil
+	})
+	db := &DB{db: srv.open(t)}
+
+	var u Uint64
+	require.NoError(t, db.QueryRow("SELECT id FROM events;").Scan(&u))
+	assert.Equal(t, uint64(math.MaxInt64)+2, u.Uint64)
+
+	var n int64
+	assert.Error(t, db.QueryRow("SELECT id FROM events;").Scan(&n), "overflows an int64")
+}
+
+func TestUint64Invalid(t *testing.T) {
+	var u Uint64
+	for _, src := range []interface{}{[]byte("18446744073709551616"), []byte("-1"), "abc", int64(-1), 1.5} {
+		assert.Error(t, u.Scan(src), "%v", src)
+	}
+	assert.False(t, u.Valid)
+}
+
+func TestUint64Value(t *testing.T) {
+	v, err := Uint64{Uint64: math.MaxUint64, Valid: true}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), v)
+
+	v, err = Uint64{Uint64: 42, Valid: true}.Value()
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), v)
+
+	u := Uint64{Uint64: 42, Valid: true}
+	require.NoError(t, u.Scan(nil))
+	assert.Equal(t, Uint64{}, u)
+	v, err = u.Value()
+	require.NoError(t, err)
+	assert.Nil(t, v)
+}
+
+func TestYearScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Year
+	}{
+		{[]byte("2024"), 2024},
+		{[]byte("1901"), 1901},
+		{[]byte("2155"), 2155},
+		{int64(1999), 1999},
+	}
+	for _, test := range tests {
+		var y Year
+		require.NoError(t, y.Scan(test.src), "%v", test.src)
+		assert.Equal(t, test.want, y, "%v", test.src)
+
+		v, err := y.Value()
+		require.NoError(t, err)
+		assert.Equal(t, int64(test.want), v)
+	}
+}
+
+func TestYearZero(t *testing.T) {
+	for _, src := range []interface{}{[]byte("0000"), []byte("0"), int64(0)} {
+		y := Year(2024)
+		require.NoError(t, y.Scan(src), "%v", src)
+		assert.Zero(t, y)
+	}
+
+	v, err := Year(0).Value()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v)
+}
+
+func TestYearInvalid(t *testing.T) {
+	for _, src := range []interface{}{[]byte("1900"), []byte("2156"), int64(-1), []byte("20x4"), []byte(""), "2024", nil} {
+		var y Year
+		assert.Error(t, y.Scan(src), "%v", src)
+	}
+
+	_, err := Year(1900).Value()
+	assert.Error(t, err)
+	_, err = Year(2156).Value()
+	assert.Error(t, err)
+}